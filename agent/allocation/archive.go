@@ -0,0 +1,164 @@
+package allocation
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/da-moon/soil/manifest"
+	"github.com/hashicorp/go-multierror"
+)
+
+// IsArchive returns true if blob is archive extracted to directory
+func (b *Blob) IsArchive() (ok bool) {
+	ok = b.Kind == manifest.BlobKindArchive
+	return
+}
+
+// SetArchive sets archive digest and paths from source
+func (b *Blob) SetArchive() (err error) {
+	sum := sha256.Sum256([]byte(b.Source))
+	b.Digest = hex.EncodeToString(sum[:])
+	b.Paths = nil
+	seen := map[string]struct{}{}
+	err = b.walkArchive(func(path string, header *tar.Header, r io.Reader) (err error) {
+		for p := path; p != "."; p = filepath.Dir(p) {
+			if _, ok := seen[p]; ok {
+				break
+			}
+			seen[p] = struct{}{}
+			b.Paths = append(b.Paths, p)
+		}
+		return
+	})
+	sort.Strings(b.Paths)
+	return
+}
+
+// Extract verifies archive and extracts it to blob directory. Files are
+// written atomically.
+func (b *Blob) Extract() (err error) {
+	if err = b.Verify(); err != nil {
+		return
+	}
+	dirPermissions := b.DirPermissions
+	if dirPermissions == 0 {
+		dirPermissions = defaultBlobDirPermissions
+	}
+	if err = os.MkdirAll(b.Name, os.FileMode(dirPermissions)); err != nil {
+		return
+	}
+	err = b.walkArchive(func(path string, header *tar.Header, r io.Reader) (err error) {
+		target := filepath.Join(b.Name, path)
+		if header.Typeflag == tar.TypeDir {
+			err = os.MkdirAll(target, os.FileMode(dirPermissions))
+			return
+		}
+		src, err := ioutil.ReadAll(r)
+		if err != nil {
+			return
+		}
+		file := &Blob{
+			Name:           target,
+			Permissions:    int(header.FileInfo().Mode().Perm()),
+			DirPermissions: dirPermissions,
+			Owner:          b.Owner,
+			Group:          b.Group,
+			Source:         string(src),
+		}
+		err = file.Write()
+		return
+	})
+	return
+}
+
+// RemovePaths removes given paths relative to blob directory. Files are
+// removed before directories and directories which are not empty are left
+// intact.
+func (b *Blob) RemovePaths(paths []string) (err error) {
+	err = &multierror.Error{}
+	sorted := append([]string{}, paths...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	for _, path := range sorted {
+		target := filepath.Join(b.Name, path)
+		info, statErr := os.Lstat(target)
+		if os.IsNotExist(statErr) {
+			continue
+		}
+		if info != nil && info.IsDir() {
+			os.Remove(target)
+			continue
+		}
+		if removeErr := os.Remove(target); removeErr != nil {
+			err = multierror.Append(err, removeErr)
+		}
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+// Remove removes archive paths and blob directory if it is empty
+func (b *Blob) Remove() (err error) {
+	if !b.IsArchive() {
+		err = os.Remove(b.Name)
+		return
+	}
+	if err = b.RemovePaths(b.Paths); err != nil {
+		return
+	}
+	os.Remove(b.Name)
+	return
+}
+
+// walkArchive calls function for each regular file and directory in tar or
+// tar.gz source. Paths are relative and cleaned. Paths which lead outside of
+// archive root are rejected.
+func (b *Blob) walkArchive(fn func(path string, header *tar.Header, r io.Reader) error) (err error) {
+	var r io.Reader = strings.NewReader(b.Source)
+	if strings.HasPrefix(b.Source, "\x1f\x8b") {
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(bytes.NewReader([]byte(b.Source))); err != nil {
+			return
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		var header *tar.Header
+		header, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			return
+		}
+		if err != nil {
+			err = fmt.Errorf(`blob %s: %v`, b.Name, err)
+			return
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+		path := filepath.Clean(filepath.FromSlash(header.Name))
+		if path == "." {
+			continue
+		}
+		if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+			err = fmt.Errorf(`blob %s: illegal path in archive: %s`, b.Name, header.Name)
+			return
+		}
+		if err = fn(path, header, tr); err != nil {
+			return
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package allocation
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
 const (
@@ -33,11 +38,20 @@ func (s *BlobSlice) AppendItem(v Asset) {
 	*s = append(*s, v.(*Blob))
 }
 
+const defaultBlobDirPermissions = 0755
+
 type Blob struct {
-	Name        string
-	Permissions int    `json:",omitempty"`
-	Leave       bool   `json:",omitempty"`
-	Source      string `json:"-"`
+	Name           string
+	Permissions    int      `json:",omitempty"`
+	DirPermissions int      `json:",omitempty"`
+	Owner          string   `json:",omitempty"`
+	Group          string   `json:",omitempty"`
+	SHA256         string   `json:",omitempty"`
+	Leave          bool     `json:",omitempty"`
+	Kind           string   `json:",omitempty"` // Empty for file or "archive"
+	Paths          []string `json:",omitempty"` // Paths extracted from archive relative to blob name
+	Digest         string   `json:",omitempty"` // SHA-256 of archive
+	Source         string   `json:"-"`
 }
 
 func (b *Blob) MarshalSpec(w io.Writer) (err error) {
@@ -65,7 +79,11 @@ func (b *Blob) UnmarshalSpec(line string, spec Spec, paths SystemPaths) (err err
 			return
 		}
 	}
-	src, err := ioutil.ReadFile(b.Name)
+	if b.IsArchive() {
+		// archive source is not kept on disk, use digest to compare
+		return
+	}
+	src, err := ioutil.ReadFile(paths.Resolve(b.Name))
 	if err != nil {
 		return
 	}
@@ -73,10 +91,146 @@ func (b *Blob) UnmarshalSpec(line string, spec Spec, paths SystemPaths) (err err
 	return
 }
 
+// Verify checks blob source against expected checksum if defined
+func (b *Blob) Verify() (err error) {
+	if b.SHA256 == "" {
+		return
+	}
+	sum := sha256.Sum256([]byte(b.Source))
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, b.SHA256) {
+		err = fmt.Errorf(`blob %s: sha256 mismatch: expected %s, actual %s`, b.Name, b.SHA256, actual)
+	}
+	return
+}
+
+// Write verifies blob and writes it atomically: source is written to
+// temporary file in the same directory which is synced and renamed to blob
+// name. Symlinks are resolved and their targets are replaced. Files which
+// can't be replaced (bind mounts, dangling symlinks) are written in place.
 func (b *Blob) Write() (err error) {
-	if err = os.MkdirAll(filepath.Dir(b.Name), os.FileMode(b.Permissions)); err != nil {
+	if err = b.Verify(); err != nil {
+		return
+	}
+	uid, gid, err := b.ownership()
+	if err != nil {
+		return
+	}
+	dirPermissions := b.DirPermissions
+	if dirPermissions == 0 {
+		dirPermissions = defaultBlobDirPermissions
+	}
+	if err = os.MkdirAll(filepath.Dir(b.Name), os.FileMode(dirPermissions)); err != nil {
+		return
+	}
+	target := b.Name
+	if info, lstatErr := os.Lstat(b.Name); lstatErr == nil && info.Mode()&os.ModeSymlink != 0 {
+		if target, err = filepath.EvalSymlinks(b.Name); err != nil {
+			err = b.writeInPlace(b.Name, uid, gid)
+			return
+		}
+	}
+	if err = b.writeAtomic(target, uid, gid); err != nil {
+		if linkErr, ok := err.(*os.LinkError); ok && (linkErr.Err == syscall.EBUSY || linkErr.Err == syscall.EXDEV) {
+			err = b.writeInPlace(target, uid, gid)
+		}
+	}
+	return
+}
+
+// writeAtomic writes source to temporary file and renames it to target.
+// Parent directory is synced after rename.
+func (b *Blob) writeAtomic(target string, uid, gid int) (err error) {
+	dir := filepath.Dir(target)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(target)+".soil-")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if err = b.writeTo(tmp, uid, gid); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return
+	}
+	err = syncDir(dir)
+	return
+}
+
+// writeInPlace truncates and writes existing file without replacing it
+func (b *Blob) writeInPlace(target string, uid, gid int) (err error) {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(b.Permissions))
+	if err != nil {
+		return
+	}
+	if err = b.writeTo(f, uid, gid); err != nil {
+		f.Close()
+		return
+	}
+	err = f.Close()
+	return
+}
+
+// writeTo writes source to file, sets permissions and ownership and syncs
+// file
+func (b *Blob) writeTo(f *os.File, uid, gid int) (err error) {
+	if _, err = f.WriteString(b.Source); err != nil {
+		return
+	}
+	if err = f.Chmod(os.FileMode(b.Permissions)); err != nil {
 		return
 	}
-	err = ioutil.WriteFile(b.Name, []byte(b.Source), os.FileMode(b.Permissions))
+	if uid != -1 || gid != -1 {
+		if err = f.Chown(uid, gid); err != nil {
+			return
+		}
+	}
+	err = f.Sync()
+	return
+}
+
+// syncDir syncs directory to persist renames
+func syncDir(path string) (err error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+	err = dir.Sync()
+	return
+}
+
+// ownership returns uid and gid of blob owner and group or -1 if not defined
+func (b *Blob) ownership() (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if b.Owner != "" {
+		if uid, err = strconv.Atoi(b.Owner); err != nil {
+			var u *user.User
+			if u, err = user.Lookup(b.Owner); err != nil {
+				return
+			}
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return
+			}
+		}
+	}
+	if b.Group != "" {
+		if gid, err = strconv.Atoi(b.Group); err != nil {
+			var g *user.Group
+			if g, err = user.LookupGroup(b.Group); err != nil {
+				return
+			}
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return
+			}
+		}
+	}
 	return
 }
@@ -4,9 +4,16 @@
 package allocation_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/manifest"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -43,3 +50,247 @@ func TestBlob_MarshalLine(t *testing.T) {
 	assert.NoError(t, b.MarshalSpec(&buf))
 	assert.Equal(t, "### BLOB {\"Name\":\"testdata/blob.txt\",\"Leave\":true}\n", buf.String())
 }
+
+func TestBlob_Write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-blob")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run(`0 write`, func(t *testing.T) {
+		b := &allocation.Blob{
+			Name:           filepath.Join(dir, "a", "b", "blob.txt"),
+			Permissions:    0600,
+			DirPermissions: 0700,
+			SHA256:         "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			Source:         "hello",
+		}
+		assert.NoError(t, b.Write())
+		src, err := ioutil.ReadFile(b.Name)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(src))
+		info, err := os.Stat(b.Name)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		info, err = os.Stat(filepath.Dir(b.Name))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+		files, err := ioutil.ReadDir(filepath.Dir(b.Name))
+		assert.NoError(t, err)
+		assert.Len(t, files, 1, "temporary files should be removed")
+	})
+	t.Run(`1 checksum mismatch`, func(t *testing.T) {
+		b := &allocation.Blob{
+			Name:        filepath.Join(dir, "a", "b", "blob.txt"),
+			Permissions: 0644,
+			SHA256:      "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			Source:      "changed",
+		}
+		assert.Error(t, b.Write())
+		src, err := ioutil.ReadFile(b.Name)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(src))
+	})
+	t.Run(`2 spec`, func(t *testing.T) {
+		b := allocation.Blob{
+			Name:           filepath.Join(dir, "a", "b", "blob.txt"),
+			Permissions:    0600,
+			DirPermissions: 0700,
+			Owner:          "root",
+			Group:          "0",
+			SHA256:         "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			Source:         "hello",
+		}
+		var buf bytes.Buffer
+		assert.NoError(t, b.MarshalSpec(&buf))
+		var recovered allocation.Blob
+		assert.NoError(t, (&recovered).UnmarshalSpec(buf.String(), allocation.Spec{
+			Revision: allocation.SpecRevision,
+		}, allocation.SystemPaths{}))
+		assert.Equal(t, b, recovered)
+	})
+	t.Run(`3 symlink`, func(t *testing.T) {
+		target := filepath.Join(dir, "target.txt")
+		assert.NoError(t, ioutil.WriteFile(target, []byte("old"), 0644))
+		link := filepath.Join(dir, "link.txt")
+		assert.NoError(t, os.Symlink(target, link))
+		b := &allocation.Blob{
+			Name:        link,
+			Permissions: 0644,
+			Source:      "hello",
+		}
+		assert.NoError(t, b.Write())
+		info, err := os.Lstat(link)
+		assert.NoError(t, err)
+		assert.True(t, info.Mode()&os.ModeSymlink != 0, "symlink should be kept")
+		src, err := ioutil.ReadFile(target)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(src))
+	})
+	t.Run(`4 dangling symlink`, func(t *testing.T) {
+		target := filepath.Join(dir, "dangling-target.txt")
+		link := filepath.Join(dir, "dangling.txt")
+		assert.NoError(t, os.Symlink(target, link))
+		b := &allocation.Blob{
+			Name:        link,
+			Permissions: 0644,
+			Source:      "hello",
+		}
+		assert.NoError(t, b.Write())
+		src, err := ioutil.ReadFile(target)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(src))
+	})
+}
+
+func TestBlob_FromManifestEncoded(t *testing.T) {
+	makePod := func(blob manifest.Blob) (res *allocation.Pod) {
+		res = &allocation.Pod{
+			UnitFile: allocation.UnitFile{
+				SystemPaths: allocation.DefaultSystemPaths(),
+			},
+		}
+		assert.NoError(t, res.FromManifest(&manifest.Pod{
+			Namespace: "private",
+			Name:      "binary",
+			Runtime:   true,
+			Target:    "multi-user.target",
+			Blobs:     manifest.Blobs{blob},
+			Units: manifest.Units{
+				{Name: "binary.service", Source: "# ${blob.etc-binary}"},
+			},
+		}, map[string]string{}))
+		return
+	}
+	encoded := makePod(manifest.Blob{
+		Name:     "/etc/binary",
+		Encoding: manifest.BlobEncodingBase64,
+		Source:   "aGVsbG8Ad29ybGQ=",
+	})
+	plain := makePod(manifest.Blob{
+		Name:   "/etc/binary",
+		Source: "hello\x00world",
+	})
+	assert.Equal(t, "hello\x00world", encoded.Blobs[0].Source)
+	assert.Equal(t, plain.Units[0].Source, encoded.Units[0].Source)
+
+	t.Run(`bad encoding`, func(t *testing.T) {
+		alloc := &allocation.Pod{}
+		assert.Error(t, alloc.FromManifest(&manifest.Pod{
+			Name:  "binary",
+			Blobs: manifest.Blobs{{Name: "/etc/binary", Encoding: manifest.BlobEncodingBase64, Source: "!!!"}},
+		}, map[string]string{}))
+	})
+}
+
+func makeArchive(t *testing.T, compress bool, files map[string]string) (res string) {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for name, content := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0640,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	if gz != nil {
+		assert.NoError(t, gz.Close())
+	}
+	res = buf.String()
+	return
+}
+
+func TestBlob_Archive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := &allocation.Blob{
+		Name: filepath.Join(dir, "static"),
+		Kind: manifest.BlobKindArchive,
+		Source: makeArchive(t, true, map[string]string{
+			"index.html":     "index",
+			"css/main.css":   "css",
+			"./css/more.css": "more",
+		}),
+	}
+	t.Run(`0 paths`, func(t *testing.T) {
+		assert.NoError(t, b.SetArchive())
+		assert.Equal(t, []string{"css", "css/main.css", "css/more.css", "index.html"}, b.Paths)
+		assert.Len(t, b.Digest, 64)
+	})
+	t.Run(`1 extract`, func(t *testing.T) {
+		assert.NoError(t, b.Extract())
+		src, err := ioutil.ReadFile(filepath.Join(dir, "static", "css", "main.css"))
+		assert.NoError(t, err)
+		assert.Equal(t, "css", string(src))
+		info, err := os.Stat(filepath.Join(dir, "static", "index.html"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	})
+	t.Run(`2 spec`, func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, b.MarshalSpec(&buf))
+		var recovered allocation.Blob
+		assert.NoError(t, (&recovered).UnmarshalSpec(buf.String(), allocation.Spec{
+			Revision: allocation.SpecRevision,
+		}, allocation.SystemPaths{}))
+		assert.Equal(t, b.Paths, recovered.Paths)
+		assert.Equal(t, b.Digest, recovered.Digest)
+		assert.Equal(t, "", recovered.Source)
+	})
+	t.Run(`3 remove`, func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "static", "css", "foreign.css"), nil, 0644))
+		assert.NoError(t, b.Remove())
+		_, err := os.Stat(filepath.Join(dir, "static", "index.html"))
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(dir, "static", "css", "foreign.css"))
+		assert.NoError(t, err, "foreign files should be left intact")
+	})
+	t.Run(`4 illegal path`, func(t *testing.T) {
+		bad := &allocation.Blob{
+			Name:   filepath.Join(dir, "bad"),
+			Kind:   manifest.BlobKindArchive,
+			Source: makeArchive(t, false, map[string]string{"../escape": "x"}),
+		}
+		assert.Error(t, bad.SetArchive())
+		assert.Error(t, bad.Extract())
+		_, err := os.Stat(filepath.Join(dir, "escape"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestBlob_FromManifestSourceFile(t *testing.T) {
+	alloc := &allocation.Pod{
+		UnitFile: allocation.UnitFile{
+			SystemPaths: allocation.DefaultSystemPaths(),
+		},
+	}
+	assert.NoError(t, alloc.FromManifest(&manifest.Pod{
+		Namespace: "private",
+		Name:      "file",
+		Runtime:   true,
+		Target:    "multi-user.target",
+		Blobs: manifest.Blobs{
+			{Name: "/etc/file", SourceFile: "testdata/blob.txt"},
+		},
+	}, map[string]string{}))
+	assert.Equal(t, "a\nb\n123\n", alloc.Blobs[0].Source)
+
+	t.Run(`missing`, func(t *testing.T) {
+		assert.Error(t, (&allocation.Pod{}).FromManifest(&manifest.Pod{
+			Name:  "file",
+			Blobs: manifest.Blobs{{Name: "/etc/file", SourceFile: "testdata/missing.txt"}},
+		}, map[string]string{}))
+	})
+}
@@ -1,8 +1,25 @@
 package allocation
 
-import "github.com/coreos/go-systemd/v22/dbus"
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
 
-const DefaultPodPrefix = "pod-*"
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	DefaultPodPrefix = "pod-*"
+
+	transientSpecEnv = "SOIL_POD" // environment variable with transient pod unit source
+)
 
 func dbusDiscoveryFunc(prefix ...string) (res []string, err error) {
 	conn, err := dbus.New()
@@ -15,19 +32,226 @@ func dbusDiscoveryFunc(prefix ...string) (res []string, err error) {
 	if err != nil {
 		return
 	}
+	transientDir := DefaultSystemPaths().Transient()
 	for _, f := range files {
+		if filepath.Dir(f.Path) == transientDir {
+			// transient pods are recovered from unit properties
+			continue
+		}
 		res = append(res, f.Path)
 	}
 	return
 }
 
+// runningUsers returns paths of all running systemd user instances
+func runningUsers() (res []SystemPaths, err error) {
+	entries, err := ioutil.ReadDir(dirUserRuntimeRoot)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if _, convErr := strconv.Atoi(entry.Name()); convErr != nil || !entry.IsDir() {
+			continue
+		}
+		u, lookupErr := user.LookupId(entry.Name())
+		if lookupErr != nil {
+			continue
+		}
+		paths, pathsErr := UserSystemPaths(u.Username)
+		if pathsErr != nil {
+			continue
+		}
+		res = append(res, paths)
+	}
+	return
+}
+
+// userDiscoveryFunc scans unit directories of all running systemd user
+// instances for files matching given patterns
+func userDiscoveryFunc(prefix ...string) (res []string, err error) {
+	users, err := runningUsers()
+	if err != nil {
+		return
+	}
+	for _, paths := range users {
+		for _, dir := range []string{paths.Local, paths.Runtime} {
+			for _, p := range prefix {
+				matches, _ := filepath.Glob(filepath.Join(dir, p))
+				res = append(res, matches...)
+			}
+		}
+	}
+	return
+}
+
+// transientDiscoveryFunc returns sources of transient pod units matching
+// given patterns by pod unit paths
+func transientDiscoveryFunc(paths SystemPaths, prefix ...string) (res map[string]string, err error) {
+	conn, err := NewSystemdConn(paths.User)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	units, err := conn.ListUnitsByPatterns([]string{}, prefix)
+	if err != nil {
+		return
+	}
+	res = map[string]string{}
+	for _, u := range units {
+		transient, propErr := conn.GetUnitProperty(u.Name, "Transient")
+		if propErr != nil {
+			continue
+		}
+		if v, ok := transient.Value.Value().(bool); !ok || !v {
+			continue
+		}
+		env, propErr := conn.GetServiceProperty(u.Name, "Environment")
+		if propErr != nil {
+			continue
+		}
+		vars, _ := env.Value.Value().([]string)
+		for _, v := range vars {
+			if source, ok := DecodeTransientSpec(v); ok {
+				res[filepath.Join(paths.Transient(), u.Name)] = source
+			}
+		}
+	}
+	return
+}
+
+// DefaultTransientDiscoveryFunc returns sources of transient pod units in
+// system and all running user instances
+func DefaultTransientDiscoveryFunc() (res map[string]string, err error) {
+	if res, err = transientDiscoveryFunc(DefaultSystemPaths(), DefaultPodPrefix); err != nil {
+		return
+	}
+	users, err := runningUsers()
+	for _, paths := range users {
+		userRes, userErr := transientDiscoveryFunc(paths, DefaultPodPrefix)
+		if userErr != nil {
+			continue
+		}
+		for k, v := range userRes {
+			res[k] = v
+		}
+	}
+	return
+}
+
+// EncodeTransientSpec returns environment variable with transient pod unit
+// source
+func EncodeTransientSpec(source string) (res string) {
+	res = transientSpecEnv + "=" + base64.StdEncoding.EncodeToString([]byte(source))
+	return
+}
+
+// DecodeTransientSpec returns transient pod unit source from environment
+// variable
+func DecodeTransientSpec(env string) (res string, ok bool) {
+	encoded := strings.TrimPrefix(env, transientSpecEnv+"=")
+	if encoded == env {
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return
+	}
+	res, ok = string(raw), true
+	return
+}
+
 func DefaultDbusDiscoveryFunc() (res []string, err error) {
-	res, err = dbusDiscoveryFunc(DefaultPodPrefix)
+	if res, err = dbusDiscoveryFunc(DefaultPodPrefix); err != nil {
+		return
+	}
+	userPaths, err := userDiscoveryFunc(DefaultPodPrefix)
+	res = append(res, userPaths...)
 	return
 }
 
+// GetGlobDiscoveryFunc returns discovery function which scans given
+// directories for pod units without dbus
+func GetGlobDiscoveryFunc(dirs ...string) func() ([]string, error) {
+	return func() (res []string, err error) {
+		seen := map[string]struct{}{}
+		for _, dir := range dirs {
+			var matches []string
+			if matches, err = filepath.Glob(filepath.Join(dir, DefaultPodPrefix+".service")); err != nil {
+				return
+			}
+			for _, match := range matches {
+				if _, ok := seen[match]; !ok {
+					seen[match] = struct{}{}
+					res = append(res, match)
+				}
+			}
+		}
+		return
+	}
+}
+
 func GetZeroDiscoveryFunc(paths ...string) func() ([]string, error) {
 	return func() ([]string, error) {
 		return paths, nil
 	}
 }
+
+// NewSystemdConn returns connection to systemd instance. Empty user means
+// system instance. Systemd user instance is connected directly by its
+// private socket.
+func NewSystemdConn(userName string) (conn *dbus.Conn, err error) {
+	if userName == "" {
+		conn, err = dbus.New()
+		return
+	}
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return
+	}
+	address := fmt.Sprintf("unix:path=%s", filepath.Join(dirUserRuntimeRoot, u.Uid, "systemd", "private"))
+	conn, err = dbus.NewConnection(func() (c *godbus.Conn, err error) {
+		if c, err = godbus.Dial(address, godbus.WithContext(context.Background())); err != nil {
+			return
+		}
+		if err = c.Auth([]godbus.Auth{godbus.AuthExternal(strconv.Itoa(os.Getuid()))}); err != nil {
+			c.Close()
+		}
+		return
+	})
+	return
+}
+
+// IsActive returns true if all pod units which are started on create are
+// active
+func (p *Pod) IsActive() (ok bool, err error) {
+	var names []string
+	for _, u := range p.Units {
+		if u.Create == "start" || u.Create == "restart" {
+			names = append(names, u.UnitName())
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	conn, err := NewSystemdConn(p.SystemPaths.User)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	statuses, err := conn.ListUnitsByNames(names)
+	if err != nil {
+		return
+	}
+	for _, status := range statuses {
+		if status.ActiveState != "active" {
+			return
+		}
+	}
+	ok = len(statuses) == len(names)
+	return
+}
@@ -15,6 +15,8 @@ type Header struct {
 	PodMark   uint64
 	AgentMark uint64
 	Namespace string
+	User      string `json:",omitempty" hash:"ignore"` // systemd user instance owner, covered by PodMark
+	Mode      string `json:",omitempty" hash:"ignore"` // pod mode, covered by PodMark
 }
 
 func (h *Header) Mark() (res uint64) {
@@ -1,8 +1,24 @@
 package allocation
 
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	dirUserRuntimeRoot = "/run/user"
+	dirUserLocal       = ".config/systemd/user"
+	dirUserRuntime     = "systemd/user"
+	dirTransient       = "transient"
+)
+
 type SystemPaths struct {
 	Local   string
 	Runtime string
+	User    string // owner of systemd user instance or empty for system instance
+	Root    string // root of offline filesystem copy to read recorded paths from or empty for live host
 }
 
 func DefaultSystemPaths() SystemPaths {
@@ -11,3 +27,83 @@ func DefaultSystemPaths() SystemPaths {
 		Runtime: dirSystemDRuntime,
 	}
 }
+
+// UserSystemPaths returns paths of systemd user instance for given user
+func UserSystemPaths(name string) (res SystemPaths, err error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return
+	}
+	res = SystemPaths{
+		Local:   filepath.Join(u.HomeDir, dirUserLocal),
+		Runtime: filepath.Join(dirUserRuntimeRoot, u.Uid, dirUserRuntime),
+		User:    u.Username,
+	}
+	return
+}
+
+// WithRoot returns paths with given root
+func (p SystemPaths) WithRoot(root string) (res SystemPaths) {
+	res = p
+	res.Root = root
+	return
+}
+
+// Resolve returns location of recorded path on live host or in offline copy
+func (p SystemPaths) Resolve(path string) (res string) {
+	if p.Root == "" {
+		res = path
+		return
+	}
+	res = filepath.Join(p.Root, path)
+	return
+}
+
+// Transient returns directory where systemd keeps transient units
+func (p SystemPaths) Transient() (res string) {
+	res = filepath.Join(filepath.Dir(p.Runtime), dirTransient)
+	return
+}
+
+// Chown sets owner of given path to systemd user instance owner. Chown does
+// nothing for system instance.
+func (p SystemPaths) Chown(path string) (err error) {
+	if p.User == "" {
+		return
+	}
+	u, err := user.Lookup(p.User)
+	if err != nil {
+		return
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return
+	}
+	err = os.Lchown(path, uid, gid)
+	return
+}
+
+// MkdirAll creates directory with all parents. Created directories are owned
+// by systemd user instance owner.
+func (p SystemPaths) MkdirAll(dir string) (err error) {
+	var missing []string
+	for d := dir; d != filepath.Dir(d); d = filepath.Dir(d) {
+		if _, statErr := os.Stat(d); statErr == nil {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	for _, d := range missing {
+		if err = p.Chown(d); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,55 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package allocation_test
+
+import (
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserSystemPaths(t *testing.T) {
+	current, err := user.Current()
+	assert.NoError(t, err)
+
+	t.Run(`0 paths`, func(t *testing.T) {
+		paths, err := allocation.UserSystemPaths(current.Username)
+		assert.NoError(t, err)
+		assert.Equal(t, allocation.SystemPaths{
+			Local:   filepath.Join(current.HomeDir, ".config/systemd/user"),
+			Runtime: filepath.Join("/run/user", current.Uid, "systemd/user"),
+			User:    current.Username,
+		}, paths)
+	})
+	t.Run(`1 unknown user`, func(t *testing.T) {
+		_, err := allocation.UserSystemPaths("soil-nonexistent-user")
+		assert.Error(t, err)
+	})
+	t.Run(`2 pod`, func(t *testing.T) {
+		alloc := &allocation.Pod{
+			UnitFile: allocation.UnitFile{
+				SystemPaths: allocation.DefaultSystemPaths(),
+			},
+		}
+		assert.NoError(t, alloc.FromManifest(&manifest.Pod{
+			Namespace: "private",
+			Name:      "dev",
+			Runtime:   true,
+			User:      current.Username,
+			Target:    "default.target",
+			Units: manifest.Units{
+				{Name: "dev.service", Transition: manifest.Transition{Create: "start"}},
+			},
+		}, map[string]string{}))
+		runtime := filepath.Join("/run/user", current.Uid, "systemd/user")
+		assert.Equal(t, current.Username, alloc.Header.User)
+		assert.Equal(t, filepath.Join(runtime, "pod-private-dev.service"), alloc.UnitFile.Path)
+		assert.Equal(t, filepath.Join(runtime, "dev.service"), alloc.Units[0].Path)
+		assert.True(t, alloc.Units[0].IsRuntime())
+		assert.Equal(t, current.Username, alloc.Units[0].SystemPaths.User)
+	})
+}
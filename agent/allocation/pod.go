@@ -3,6 +3,9 @@ package allocation
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/da-moon/soil/manifest"
@@ -21,11 +24,36 @@ WantedBy=${pod.target}
 `
 	dirSystemDLocal   = "/etc/systemd/system"
 	dirSystemDRuntime = "/run/systemd/system"
+
+	ModeTransient = "transient" // pod units are created by StartTransientUnit
 )
 
 // Allocations state
 type PodSlice []*Pod
 
+// FromTransient recovers transient pods. Discovery function should return
+// pod unit sources by pod unit paths.
+func (s *PodSlice) FromTransient(systemPaths SystemPaths, discoveryFunc func() (map[string]string, error)) (err error) {
+	sources, err := discoveryFunc()
+	var failures []error
+	for path, source := range sources {
+		pod := &Pod{
+			UnitFile: UnitFile{
+				SystemPaths: systemPaths,
+			},
+		}
+		if parseErr := pod.FromTransient(path, source); parseErr != nil {
+			failures = append(failures, parseErr)
+			continue
+		}
+		*s = append(*s, pod)
+	}
+	if len(failures) > 0 {
+		err = fmt.Errorf("%v", failures)
+	}
+	return
+}
+
 func (s *PodSlice) FromFilesystem(systemPaths SystemPaths, discoveryFunc func() ([]string, error)) (err error) {
 	paths, err := discoveryFunc()
 	var failures []error
@@ -55,6 +83,8 @@ type Pod struct {
 	Blobs     BlobSlice
 	Resources ResourceSlice
 	Providers ProviderSlice
+
+	SecretKey *manifest.SecretKey `json:"-"` // Key to decrypt pod secrets. Secrets are not interpolated if not defined
 }
 
 func (p *Pod) FromManifest(m *manifest.Pod, env map[string]string) (err error) {
@@ -64,18 +94,42 @@ func (p *Pod) FromManifest(m *manifest.Pod, env map[string]string) (err error) {
 		PodMark:   m.Mark(),
 		AgentMark: agentMark,
 		Namespace: m.Namespace,
+		User:      m.User,
+		Mode:      m.Mode,
+	}
+	transient := m.Mode == ModeTransient
+	if m.Mode != "" && !transient {
+		err = fmt.Errorf(`pod %s: unknown mode %s`, m.Name, m.Mode)
+		return
+	}
+	if m.User != "" {
+		if p.SystemPaths, err = UserSystemPaths(m.User); err != nil {
+			return
+		}
+	}
+	baseEnv := map[string]string{
+		"pod.name":      m.Name,
+		"pod.namespace": m.Namespace,
 	}
 	e := manifest.FlatMap{
 		"pod.name":      m.Name,
 		"pod.namespace": m.Namespace,
 		"pod.target":    m.Target,
 	}.Merge(env)
-
-	p.UnitFile = NewUnitFile(fmt.Sprintf("pod-%s-%s.service", m.Namespace, m.Name), p.SystemPaths, m.Runtime)
-	baseEnv := map[string]string{
-		"pod.name":      m.Name,
-		"pod.namespace": m.Namespace,
+	if p.SecretKey != nil {
+		secrets := manifest.FlatMap{}
+		for _, secret := range m.Secrets {
+			var value string
+			if value, err = p.SecretKey.Decrypt(secret.Value); err != nil {
+				err = fmt.Errorf(`pod %s: secret %s: %v`, m.Name, secret.Name, err)
+				return
+			}
+			secrets[fmt.Sprintf("secret.%s", manifest.Interpolate(secret.Name, baseEnv))] = value
+		}
+		e = e.Merge(secrets)
 	}
+
+	p.UnitFile = newPodUnitFile(fmt.Sprintf("pod-%s-%s.service", m.Namespace, m.Name), p.SystemPaths, m.Runtime, transient)
 	baseSourceEnv := map[string]string{
 		"pod.target": m.Target,
 	}
@@ -84,10 +138,28 @@ func (p *Pod) FromManifest(m *manifest.Pod, env map[string]string) (err error) {
 	fileHashes1 := manifest.FlatMap{}
 	for _, b := range m.Blobs {
 		ab := &Blob{
-			Name:        manifest.Interpolate(b.Name, baseEnv),
-			Permissions: b.Permissions,
-			Leave:       b.Leave,
-			Source:      e.Interpolate(b.Source),
+			Name:           manifest.Interpolate(b.Name, baseEnv),
+			Permissions:    b.Permissions,
+			DirPermissions: b.DirPermissions,
+			Owner:          b.Owner,
+			Group:          b.Group,
+			SHA256:         b.SHA256,
+			Leave:          b.Leave,
+			Kind:           b.Kind,
+		}
+		var source string
+		if source, err = b.ReadSource(); err != nil {
+			return
+		}
+		if !b.IsRaw() {
+			ab.Source = e.Interpolate(source)
+		} else if ab.Source, err = b.DecodeSource(source); err != nil {
+			return
+		}
+		if ab.IsArchive() {
+			if err = ab.SetArchive(); err != nil {
+				return
+			}
 		}
 		p.Blobs = append(p.Blobs, ab)
 		fileHash, _ := hashstructure.Hash(ab.Source, nil)
@@ -102,11 +174,30 @@ func (p *Pod) FromManifest(m *manifest.Pod, env map[string]string) (err error) {
 		unitName := manifest.Interpolate(u.Name, baseEnv)
 		pu := &Unit{
 			Transition: u.Transition,
-			UnitFile:   NewUnitFile(unitName, p.SystemPaths, m.Runtime),
+			UnitFile:   newPodUnitFile(unitName, p.SystemPaths, m.Runtime, transient),
+			Transient:  transient,
+		}
+		if transient && len(u.DropIns) > 0 {
+			err = fmt.Errorf(`pod %s: drop-ins are not supported for transient unit %s`, m.Name, unitName)
+			return
+		}
+		if transient && hasSecrets(u.Source) {
+			// transient unit properties and sources are readable by any user
+			err = fmt.Errorf(`pod %s: secrets are not supported in transient unit %s`, m.Name, unitName)
+			return
 		}
 		pu.Source = e.Interpolate(u.Source)
+		pu.Foreign = u.Source == "" && len(u.DropIns) > 0
+		for _, d := range u.DropIns {
+			ad := NewDropIn(manifest.Interpolate(d.Name, baseEnv), pu.UnitFile)
+			ad.Source = e.Interpolate(d.Source)
+			pu.DropIns = append(pu.DropIns, ad)
+		}
 		p.Units = append(p.Units, pu)
-		unitNames = append(unitNames, unitName)
+		if !pu.Foreign && pu.Create != "" {
+			// pod unit is ordered only before units started by pod itself
+			unitNames = append(unitNames, unitName)
+		}
 	}
 
 	p.Resources.FromManifest(*m, env)
@@ -162,6 +253,19 @@ func (p *Pod) FromFilesystem(path string) (err error) {
 	if err = p.UnitFile.Read(); err != nil {
 		return
 	}
+	err = p.fromSource()
+	return
+}
+
+// FromTransient recovers pod from transient pod unit source
+func (p *Pod) FromTransient(path, source string) (err error) {
+	p.UnitFile.Path = path
+	p.UnitFile.Source = source
+	err = p.fromSource()
+	return
+}
+
+func (p *Pod) fromSource() (err error) {
 	var spec Spec
 	if err = spec.Unmarshal(p.UnitFile.Source); err != nil {
 		return
@@ -169,6 +273,13 @@ func (p *Pod) FromFilesystem(path string) (err error) {
 	if err = p.Header.UnmarshalSpec(p.UnitFile.Source, spec, p.SystemPaths); err != nil {
 		return
 	}
+	if p.Header.User != "" {
+		root := p.SystemPaths.Root
+		if p.SystemPaths, err = UserSystemPaths(p.Header.User); err != nil {
+			return
+		}
+		p.SystemPaths.Root = root
+	}
 	if err = spec.UnmarshalAssetSlice(p.SystemPaths, &p.Units, p.UnitFile.Source); err != nil {
 		return
 	}
@@ -191,6 +302,81 @@ func (p *Pod) GetPodUnit() (res *Unit) {
 			Destroy:   "stop",
 			Permanent: true,
 		},
+		Transient: p.Mode == ModeTransient,
+		pod:       true,
+	}
+	return
+}
+
+func newPodUnitFile(unitName string, paths SystemPaths, runtime, transient bool) (f UnitFile) {
+	if transient {
+		f = NewTransientUnitFile(unitName, paths)
+		return
+	}
+	f = NewUnitFile(unitName, paths, runtime)
+	return
+}
+
+// Actual returns pod copy with pod unit, units, drop-ins and blobs read from
+// filesystem. Missing files have empty sources. Archive blobs with missing
+// paths have empty digest. Transient and foreign units are left as is.
+func (p *Pod) Actual() (res *Pod) {
+	res = &Pod{
+		Header:    p.Header,
+		UnitFile:  p.UnitFile,
+		Resources: p.Resources,
+		Providers: p.Providers,
+		SecretKey: p.SecretKey,
+	}
+	if p.Mode != ModeTransient {
+		res.UnitFile.Source = readActual(p.UnitFile.Path)
+	}
+	for _, u := range p.Units {
+		actual := *u
+		if !u.Foreign && !u.Transient {
+			actual.UnitFile.Source = readActual(u.UnitFile.Path)
+		}
+		actual.DropIns = nil
+		for _, d := range u.DropIns {
+			actualDropIn := *d
+			actualDropIn.Source = readActual(d.Path)
+			actual.DropIns = append(actual.DropIns, &actualDropIn)
+		}
+		res.Units = append(res.Units, &actual)
+	}
+	for _, b := range p.Blobs {
+		actual := *b
+		if !b.IsArchive() {
+			actual.Source = readActual(b.Name)
+		} else {
+			for _, path := range b.Paths {
+				if _, err := os.Lstat(filepath.Join(b.Name, path)); err != nil {
+					actual.Digest = ""
+					break
+				}
+			}
+		}
+		res.Blobs = append(res.Blobs, &actual)
+	}
+	return
+}
+
+// readActual returns file content or empty string if file can not be read
+func readActual(path string) (res string) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	res = string(src)
+	return
+}
+
+// hasSecrets returns true if source references secrets
+func hasSecrets(source string) (ok bool) {
+	for _, key := range manifest.ExtractEnv(source) {
+		if strings.HasPrefix(key, "secret.") {
+			return true
+		}
 	}
 	return
 }
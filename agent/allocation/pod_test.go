@@ -115,3 +115,43 @@ WantedBy=multi-user.target
 	},
 		alloc)
 }
+
+func TestPod_FromManifestSecrets(t *testing.T) {
+	key, err := manifest.GenerateSecretKey()
+	assert.NoError(t, err)
+	value, err := key.Encrypt("hunter2")
+	assert.NoError(t, err)
+	m := &manifest.Pod{
+		Namespace: "private",
+		Name:      "db",
+		Runtime:   true,
+		Target:    "multi-user.target",
+		Secrets:   manifest.Secrets{{Name: "password", Value: value}},
+		Blobs:     manifest.Blobs{{Name: "/etc/db/password", Source: "${secret.password}"}},
+		Units: manifest.Units{
+			{Name: "db.service", Source: "# ${secret.password}"},
+		},
+	}
+	t.Run(`with key`, func(t *testing.T) {
+		alloc := &allocation.Pod{
+			UnitFile: allocation.UnitFile{
+				SystemPaths: allocation.DefaultSystemPaths(),
+			},
+			SecretKey: key,
+		}
+		assert.NoError(t, alloc.FromManifest(m, map[string]string{}))
+		assert.Equal(t, "hunter2", alloc.Blobs[0].Source)
+		assert.Equal(t, "# hunter2", alloc.Units[0].Source)
+		assert.NotContains(t, alloc.Source, "hunter2", "pod unit should not contain secrets")
+	})
+	t.Run(`without key`, func(t *testing.T) {
+		alloc := &allocation.Pod{}
+		assert.NoError(t, alloc.FromManifest(m, map[string]string{}))
+		assert.Equal(t, "${secret.password}", alloc.Blobs[0].Source)
+	})
+	t.Run(`wrong key`, func(t *testing.T) {
+		other, _ := manifest.GenerateSecretKey()
+		alloc := &allocation.Pod{SecretKey: other}
+		assert.Error(t, alloc.FromManifest(m, map[string]string{}))
+	})
+}
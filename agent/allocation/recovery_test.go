@@ -19,3 +19,17 @@ func TestState_FromFS(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, state, 1)
 }
+
+func TestState_FromFSGlob(t *testing.T) {
+	paths := allocation.SystemPaths{
+		Local:   "testdata/etc",
+		Runtime: "testdata",
+	}
+	discovered, err := allocation.GetGlobDiscoveryFunc(paths.Local, paths.Runtime, paths.Runtime)()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testdata/pod-test-1.service"}, discovered)
+
+	var state allocation.PodSlice
+	assert.NoError(t, state.FromFilesystem(paths, allocation.GetGlobDiscoveryFunc(paths.Local, paths.Runtime)))
+	assert.Len(t, state, 1)
+}
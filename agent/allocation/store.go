@@ -0,0 +1,253 @@
+package allocation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	StoreVersion = 1
+
+	storeVersionFile = "VERSION"
+	storePodsDir     = "pods"
+	storeRecordExt   = ".json"
+)
+
+// Store persists allocations as versioned and checksummed JSON records in
+// agent state directory. Each pod is stored in own record which is written
+// atomically.
+type Store struct {
+	Dir         string
+	SystemPaths SystemPaths
+}
+
+func NewStore(dir string, paths SystemPaths) (s *Store) {
+	s = &Store{
+		Dir:         dir,
+		SystemPaths: paths,
+	}
+	return
+}
+
+// storeRecord is envelope of stored pod
+type storeRecord struct {
+	Version  int
+	Checksum string          // SHA-256 of data
+	Data     json.RawMessage // storedPod
+}
+
+// storedPod holds pod with sources which can not be read from filesystem
+type storedPod struct {
+	Pod     *Pod
+	Sources map[string]string `json:",omitempty"` // Sources of transient units by path
+}
+
+// IsInitialized returns true if store is initialized by Migrate
+func (s *Store) IsInitialized() (ok bool) {
+	_, err := os.Stat(filepath.Join(s.Dir, storeVersionFile))
+	ok = err == nil
+	return
+}
+
+// Migrate stores given pods and initializes store. Use Migrate to import pods
+// recovered from pod unit specs.
+func (s *Store) Migrate(pods PodSlice) (err error) {
+	err = &multierror.Error{}
+	for _, pod := range pods {
+		err = multierror.Append(err, s.Put(pod))
+	}
+	if err = err.(*multierror.Error).ErrorOrNil(); err != nil {
+		return
+	}
+	raw, err := json.Marshal(map[string]int{"Version": StoreVersion})
+	if err != nil {
+		return
+	}
+	err = writeFileAtomic(filepath.Join(s.Dir, storeVersionFile), raw)
+	return
+}
+
+// Put writes pod record. Sources of transient units are stored as is. They
+// never hold decrypted secrets because transient units can't reference
+// secrets and BLOB sources are not stored.
+func (s *Store) Put(pod *Pod) (err error) {
+	stored := storedPod{
+		Pod: pod,
+	}
+	if pod.Mode == ModeTransient {
+		stored.Sources = map[string]string{
+			pod.UnitFile.Path: pod.UnitFile.Source,
+		}
+		for _, u := range pod.Units {
+			stored.Sources[u.UnitFile.Path] = u.UnitFile.Source
+		}
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(data)
+	raw, err := json.Marshal(storeRecord{
+		Version:  StoreVersion,
+		Checksum: hex.EncodeToString(sum[:]),
+		Data:     data,
+	})
+	if err != nil {
+		return
+	}
+	err = writeFileAtomic(s.recordPath(pod.Name), raw)
+	return
+}
+
+// Delete removes pod record
+func (s *Store) Delete(name string) (err error) {
+	if err = os.Remove(s.recordPath(name)); os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// Get reads pod record. Unit, drop-in and blob sources are read from
+// filesystem. Missing files have empty sources.
+func (s *Store) Get(name string) (pod *Pod, err error) {
+	raw, err := ioutil.ReadFile(s.recordPath(name))
+	if err != nil {
+		return
+	}
+	var record storeRecord
+	if err = json.Unmarshal(raw, &record); err != nil {
+		err = fmt.Errorf(`record %s: %v`, name, err)
+		return
+	}
+	if record.Version != StoreVersion {
+		err = fmt.Errorf(`record %s: unsupported version %d`, name, record.Version)
+		return
+	}
+	sum := sha256.Sum256(record.Data)
+	if actual := hex.EncodeToString(sum[:]); actual != record.Checksum {
+		err = fmt.Errorf(`record %s: checksum mismatch: expected %s, actual %s`, name, record.Checksum, actual)
+		return
+	}
+	var stored storedPod
+	if err = json.Unmarshal(record.Data, &stored); err != nil {
+		err = fmt.Errorf(`record %s: %v`, name, err)
+		return
+	}
+	if stored.Pod == nil {
+		err = fmt.Errorf(`record %s: pod is not defined`, name)
+		return
+	}
+	pod = stored.Pod
+	if err = s.hydrate(pod, stored.Sources); err != nil {
+		err = fmt.Errorf(`record %s: %v`, name, err)
+	}
+	return
+}
+
+// Load reads all pod records. Corrupted records are skipped and reported in
+// error.
+func (s *Store) Load() (pods PodSlice, err error) {
+	err = &multierror.Error{}
+	files, readErr := ioutil.ReadDir(filepath.Join(s.Dir, storePodsDir))
+	if readErr != nil && !os.IsNotExist(readErr) {
+		err = multierror.Append(err, readErr)
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), storeRecordExt) {
+			continue
+		}
+		name, nameErr := url.PathUnescape(strings.TrimSuffix(file.Name(), storeRecordExt))
+		if nameErr != nil {
+			err = multierror.Append(err, nameErr)
+			continue
+		}
+		pod, getErr := s.Get(name)
+		if getErr != nil {
+			err = multierror.Append(err, getErr)
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+// hydrate sets system paths and reads sources of stored pod
+func (s *Store) hydrate(pod *Pod, sources map[string]string) (err error) {
+	paths := s.SystemPaths
+	if pod.User != "" {
+		if paths, err = UserSystemPaths(pod.User); err != nil {
+			return
+		}
+		paths.Root = s.SystemPaths.Root
+	}
+	pod.UnitFile.SystemPaths = paths
+	if source, ok := sources[pod.UnitFile.Path]; ok {
+		pod.UnitFile.Source = source
+	} else {
+		pod.UnitFile.Source = readActual(paths.Resolve(pod.UnitFile.Path))
+	}
+	for _, u := range pod.Units {
+		u.UnitFile.SystemPaths = paths
+		switch {
+		case u.Transient:
+			u.UnitFile.Source = sources[u.UnitFile.Path]
+		case !u.Foreign:
+			u.UnitFile.Source = readActual(paths.Resolve(u.UnitFile.Path))
+		}
+		for _, d := range u.DropIns {
+			d.SystemPaths = paths
+			d.Source = readActual(paths.Resolve(d.Path))
+		}
+	}
+	for _, b := range pod.Blobs {
+		if !b.IsArchive() {
+			b.Source = readActual(paths.Resolve(b.Name))
+		}
+	}
+	return
+}
+
+func (s *Store) recordPath(name string) (res string) {
+	res = filepath.Join(s.Dir, storePodsDir, url.PathEscape(name)+storeRecordExt)
+	return
+}
+
+// writeFileAtomic writes data to temporary file in the same directory which
+// is synced and renamed to given path
+func writeFileAtomic(path string, data []byte) (err error) {
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".soil-")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	err = os.Rename(tmp.Name(), path)
+	return
+}
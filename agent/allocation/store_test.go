@@ -0,0 +1,105 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package allocation_test
+
+import (
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	paths := allocation.SystemPaths{
+		Local:   "testdata/etc",
+		Runtime: "testdata",
+	}
+	recovered := &allocation.Pod{
+		UnitFile: allocation.UnitFile{
+			SystemPaths: paths,
+		},
+	}
+	assert.NoError(t, recovered.FromFilesystem("testdata/pod-test-1.service"))
+	store := allocation.NewStore(dir, paths)
+
+	t.Run(`0 migrate`, func(t *testing.T) {
+		assert.False(t, store.IsInitialized())
+		assert.NoError(t, store.Migrate(allocation.PodSlice{recovered}))
+		assert.True(t, store.IsInitialized())
+		pods, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, allocation.PodSlice{recovered}, pods)
+	})
+	t.Run(`1 transient`, func(t *testing.T) {
+		pod := &allocation.Pod{
+			Header: allocation.Header{
+				Name: "transient",
+				Mode: allocation.ModeTransient,
+			},
+			UnitFile: allocation.NewTransientUnitFile("pod-private-transient.service", paths),
+			Units: allocation.UnitSlice{
+				{
+					UnitFile:  allocation.NewTransientUnitFile("transient.service", paths),
+					Transient: true,
+				},
+			},
+		}
+		pod.UnitFile.Source = "pod"
+		pod.Units[0].Source = "unit"
+		assert.NoError(t, store.Put(pod))
+		res, err := store.Get("transient")
+		assert.NoError(t, err)
+		assert.Equal(t, pod, res)
+	})
+	t.Run(`2 corrupted`, func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pods", "broken.json"), []byte(`{"Version":1,"Checksum":"00","Data":{}}`), 0600))
+		pods, err := store.Load()
+		assert.Error(t, err)
+		assert.Len(t, pods, 2, "valid records should be loaded")
+	})
+	t.Run(`3 delete`, func(t *testing.T) {
+		assert.NoError(t, store.Delete("transient"))
+		assert.NoError(t, store.Delete("transient"))
+		_, err := store.Get("transient")
+		assert.Error(t, err)
+	})
+}
+
+func TestStore_Secrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := manifest.GenerateSecretKey()
+	assert.NoError(t, err)
+	value, err := key.Encrypt("hunter2")
+	assert.NoError(t, err)
+	pod := &allocation.Pod{SecretKey: key}
+	assert.NoError(t, pod.FromManifest(&manifest.Pod{
+		Namespace: "private",
+		Name:      "db",
+		Mode:      allocation.ModeTransient,
+		Target:    "multi-user.target",
+		Secrets:   manifest.Secrets{{Name: "password", Value: value}},
+		Blobs:     manifest.Blobs{{Name: filepath.Join(dir, "password"), Source: "${secret.password}"}},
+		Units: manifest.Units{
+			{Name: "db.service", Source: "[Service]\nExecStart=/usr/bin/db\n"},
+		},
+	}, map[string]string{}))
+	store := allocation.NewStore(dir, allocation.SystemPaths{})
+	assert.NoError(t, store.Put(pod))
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "pods", "db.json"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "hunter2")
+	info, err := os.Stat(filepath.Join(dir, "pods", "db.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -39,12 +40,34 @@ func (s *UnitSlice) AppendItem(v Asset) {
 type Unit struct {
 	UnitFile
 	manifest.Transition `json:",squash"`
+	Foreign             bool      `json:",omitempty"` // unit file is not managed by pod
+	Transient           bool      `json:",omitempty"` // unit is created by StartTransientUnit
+	DropIns             []*DropIn `json:",omitempty"`
+
+	pod bool // unit holds pod spec
+}
+
+// IsPodUnit returns true if unit holds pod spec
+func (u *Unit) IsPodUnit() (ok bool) {
+	ok = u.pod
+	return
+}
+
+// transientUnitSpec holds transient unit source in spec line because
+// transient units have no files to read source from
+type transientUnitSpec struct {
+	*Unit
+	Source string
 }
 
 func (u *Unit) MarshalSpec(w io.Writer) (err error) {
 	if _, err = w.Write([]byte(unitSpecPrefix)); err != nil {
 		return
 	}
+	if u.Transient {
+		err = json.NewEncoder(w).Encode(transientUnitSpec{Unit: u, Source: u.Source})
+		return
+	}
 	err = json.NewEncoder(w).Encode(u)
 	return
 }
@@ -64,15 +87,95 @@ func (u *Unit) UnmarshalSpec(line string, spec Spec, paths SystemPaths) (err err
 		}
 	case SpecRevision:
 		// v2
-		if err = json.NewDecoder(strings.NewReader(strings.TrimPrefix(line, unitSpecPrefix))).Decode(u); err != nil {
+		v := transientUnitSpec{Unit: u}
+		if err = json.NewDecoder(strings.NewReader(strings.TrimPrefix(line, unitSpecPrefix))).Decode(&v); err != nil {
+			return
+		}
+		if u.Transient {
+			u.Source = v.Source
 			return
 		}
 	}
-	src, err := ioutil.ReadFile(u.UnitFile.Path)
+	if !u.Foreign {
+		if err = u.UnitFile.Read(); err != nil {
+			return
+		}
+	}
+	for _, d := range u.DropIns {
+		d.SystemPaths = paths
+		if err = d.Read(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ownedPaths returns unit name if unit file is managed by pod and paths of
+// all unit drop-ins
+func (u *Unit) ownedPaths() (res []string) {
+	if !u.Foreign {
+		res = append(res, u.UnitName())
+	}
+	for _, d := range u.DropIns {
+		res = append(res, d.Path)
+	}
+	return
+}
+
+// DropIn is unit configuration override located in "<unit>.d" directory
+type DropIn struct {
+	SystemPaths SystemPaths `json:"-"`
+	Name        string
+	Path        string
+	Source      string `json:"-"`
+}
+
+func NewDropIn(name string, unitFile UnitFile) (d *DropIn) {
+	d = &DropIn{
+		SystemPaths: unitFile.SystemPaths,
+		Name:        name,
+		Path:        filepath.Join(unitFile.Path+".d", name),
+	}
+	return
+}
+
+func (d *DropIn) Read() (err error) {
+	src, err := ioutil.ReadFile(d.SystemPaths.Resolve(d.Path))
 	if err != nil {
 		return
 	}
-	u.UnitFile.Source = string(src)
+	d.Source = string(src)
+	return
+}
+
+// Write writes drop-in atomically to not leave partially written
+// configuration if interrupted
+func (d *DropIn) Write() (err error) {
+	if err = d.SystemPaths.MkdirAll(filepath.Dir(d.Path)); err != nil {
+		return
+	}
+	blob := &Blob{
+		Name:        d.Path,
+		Permissions: 0644,
+		Source:      d.Source,
+	}
+	if err = blob.writeAtomic(d.Path, -1, -1); err != nil {
+		return
+	}
+	err = d.SystemPaths.Chown(d.Path)
+	return
+}
+
+// Remove removes drop-in and "<unit>.d" directory if it is empty. Missing
+// drop-in is not an error.
+func (d *DropIn) Remove() (err error) {
+	if err = os.Remove(d.Path); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+	if files, _ := ioutil.ReadDir(filepath.Dir(d.Path)); len(files) == 0 {
+		os.Remove(filepath.Dir(d.Path))
+	}
 	return
 }
 
@@ -82,6 +185,16 @@ type UnitFile struct {
 	Source      string `json:"-"`
 }
 
+// NewTransientUnitFile returns unit file located in directory where systemd
+// keeps transient units
+func NewTransientUnitFile(unitName string, paths SystemPaths) (f UnitFile) {
+	f = UnitFile{
+		SystemPaths: paths,
+		Path:        filepath.Join(paths.Transient(), unitName),
+	}
+	return
+}
+
 func NewUnitFile(unitName string, paths SystemPaths, runtime bool) (f UnitFile) {
 	basePath := paths.Local
 	if runtime {
@@ -95,7 +208,7 @@ func NewUnitFile(unitName string, paths SystemPaths, runtime bool) (f UnitFile)
 }
 
 func (f *UnitFile) Read() (err error) {
-	src, err := ioutil.ReadFile(f.Path)
+	src, err := ioutil.ReadFile(f.SystemPaths.Resolve(f.Path))
 	if err != nil {
 		return
 	}
@@ -104,7 +217,13 @@ func (f *UnitFile) Read() (err error) {
 }
 
 func (f *UnitFile) Write() (err error) {
-	err = ioutil.WriteFile(f.Path, []byte(f.Source), 0755)
+	if err = f.SystemPaths.MkdirAll(filepath.Dir(f.Path)); err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(f.Path, []byte(f.Source), 0755); err != nil {
+		return
+	}
+	err = f.SystemPaths.Chown(f.Path)
 	return
 }
 
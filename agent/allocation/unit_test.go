@@ -8,6 +8,9 @@ import (
 	"github.com/da-moon/soil/agent/allocation"
 	"github.com/da-moon/soil/manifest"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -48,4 +51,89 @@ func TestUnit_UnmarshalItem(t *testing.T) {
 		}, allocation.SystemPaths{}))
 		assert.Equal(t, expect, u)
 	})
+	t.Run(`2 foreign with drop-ins`, func(t *testing.T) {
+		line := `### UNIT {"Path":"testdata/docker.service","Update":"restart","Foreign":true,"DropIns":[{"Name":"10-env.conf","Path":"testdata/docker.service.d/10-env.conf"}]}`
+		var u allocation.Unit
+		assert.NoError(t, (&u).UnmarshalSpec(line, allocation.Spec{
+			Revision: allocation.SpecRevision,
+		}, allocation.SystemPaths{}))
+		assert.Equal(t, allocation.Unit{
+			UnitFile: allocation.UnitFile{
+				Path: "testdata/docker.service",
+			},
+			Transition: manifest.Transition{
+				Update: "restart",
+			},
+			Foreign: true,
+			DropIns: []*allocation.DropIn{
+				{
+					Name:   "10-env.conf",
+					Path:   "testdata/docker.service.d/10-env.conf",
+					Source: "[Service]\nEnvironment=A=1\n",
+				},
+			},
+		}, u)
+	})
+}
+
+func TestUnit_Transient(t *testing.T) {
+	u := &allocation.Unit{
+		UnitFile: allocation.NewTransientUnitFile("job.service", allocation.DefaultSystemPaths()),
+		Transition: manifest.Transition{
+			Create: "start",
+		},
+		Transient: true,
+	}
+	u.Source = "[Service]\nExecStart=/usr/bin/true\n"
+	var buf bytes.Buffer
+	assert.NoError(t, u.MarshalSpec(&buf))
+	assert.Equal(t, "### UNIT {\"Path\":\"/run/systemd/transient/job.service\",\"Create\":\"start\",\"Transient\":true,\"Source\":\"[Service]\\nExecStart=/usr/bin/true\\n\"}\n", buf.String())
+
+	var recovered allocation.Unit
+	assert.NoError(t, (&recovered).UnmarshalSpec(buf.String(), allocation.Spec{
+		Revision: allocation.SpecRevision,
+	}, allocation.DefaultSystemPaths()))
+	assert.Equal(t, *u, recovered)
+}
+
+func TestDropIn_Write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-dropin")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	d := allocation.NewDropIn("10-env.conf", allocation.UnitFile{
+		Path: filepath.Join(dir, "test.service"),
+	})
+	d.Source = "[Service]\nEnvironment=A=1\n"
+	assert.NoError(t, d.Write())
+	d.Source = "[Service]\n"
+	assert.NoError(t, d.Write())
+
+	src, err := ioutil.ReadFile(d.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "[Service]\n", string(src))
+	info, err := os.Stat(d.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	files, err := ioutil.ReadDir(filepath.Dir(d.Path))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestDropIn_Remove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-dropin")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	d := allocation.NewDropIn("10-env.conf", allocation.UnitFile{
+		Path: filepath.Join(dir, "test.service"),
+	})
+	d.Source = "[Service]\n"
+	assert.NoError(t, d.Write())
+	assert.NoError(t, d.Remove())
+	_, err = os.Stat(filepath.Join(dir, "test.service.d"))
+	assert.True(t, os.IsNotExist(err))
+
+	// already removed
+	assert.NoError(t, d.Remove())
 }
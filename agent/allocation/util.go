@@ -22,13 +22,16 @@ func IsBlocked(left, right *Pod) (err error) {
 	}
 	leftUnits := map[string]struct{}{}
 	for _, unit := range left.Units {
-		leftUnits[unit.UnitName()] = struct{}{}
+		for _, path := range unit.ownedPaths() {
+			leftUnits[path] = struct{}{}
+		}
 	}
 	for _, unit := range right.Units {
-		name := unit.UnitName()
-		if _, ok := leftUnits[name]; ok {
-			err = fmt.Errorf(`%s blocked by %s(unit:%s)`, left.Name, right.Name, right.Name)
-			return
+		for _, path := range unit.ownedPaths() {
+			if _, ok := leftUnits[path]; ok {
+				err = fmt.Errorf(`%s blocked by %s(unit:%s)`, left.Name, right.Name, right.Name)
+				return
+			}
 		}
 	}
 	return
@@ -1,9 +1,11 @@
 package api
 
 import (
+	"context"
 	"github.com/da-moon/soil/agent/api/api-server"
 	"github.com/da-moon/soil/proto"
 	"net/http"
+	"net/url"
 	"os"
 	"syscall"
 )
@@ -43,3 +45,24 @@ func NewAgentDrainDelete(fn func(on bool)) (e *api_server.Endpoint) {
 	}))
 	return
 }
+
+// NewAgentDriftGet returns drifted paths by pod
+func NewAgentDriftGet(fn func() map[string][]string) (e *api_server.Endpoint) {
+	e = api_server.GET(proto.V1AgentDrift, &agentDriftGetProcessor{
+		fn: fn,
+	})
+	return
+}
+
+type agentDriftGetProcessor struct {
+	fn func() map[string][]string
+}
+
+func (p *agentDriftGetProcessor) Empty() interface{} {
+	return nil
+}
+
+func (p *agentDriftGetProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	res = p.fn()
+	return
+}
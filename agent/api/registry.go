@@ -7,17 +7,14 @@ import (
 	"github.com/da-moon/soil/agent/api/api-server"
 	"github.com/da-moon/soil/agent/bus"
 	"github.com/da-moon/soil/manifest"
+	"github.com/da-moon/soil/proto"
 	"net/http"
 	"net/url"
 	"sync"
 )
 
-const (
-	V1Registry = "/v1/registry"
-)
-
 func NewRegistryPodsGet() (e *api_server.Endpoint) {
-	return api_server.GET(V1Registry, &registryPodsGetProcessor{
+	return api_server.GET(proto.V1Registry, &registryPodsGetProcessor{
 		pods: manifest.PodSlice{},
 	})
 }
@@ -50,8 +47,8 @@ func (p *registryPodsGetProcessor) ConsumeMessage(message bus.Message) (err erro
 }
 
 func NewRegistryPodsPut(log *logx.Log, consumer bus.Consumer) (e *api_server.Endpoint) {
-	return api_server.PUT(V1Registry, &registryPodsPutProcessor{
-		log:      log.GetLog("api", "put", V1Registry),
+	return api_server.PUT(proto.V1Registry, &registryPodsPutProcessor{
+		log:      log.GetLog("api", "put", proto.V1Registry),
 		consumer: consumer,
 	})
 }
@@ -80,8 +77,8 @@ func (p *registryPodsPutProcessor) Process(ctx context.Context, u *url.URL, v in
 }
 
 func NewRegistryPodsDelete(log *logx.Log, consumer bus.Consumer) (e *api_server.Endpoint) {
-	return api_server.DELETE(V1Registry, &registryPodsDeleteProcessor{
-		log:      log.GetLog("api", "delete", V1Registry),
+	return api_server.DELETE(proto.V1Registry, &registryPodsDeleteProcessor{
+		log:      log.GetLog("api", "delete", proto.V1Registry),
 		consumer: consumer,
 	})
 }
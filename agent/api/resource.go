@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"github.com/da-moon/soil/agent/api/api-server"
+	"github.com/da-moon/soil/proto"
+	"net/url"
+)
+
+// NewProvidersGet returns providers on agent
+func NewProvidersGet(fn func() proto.ProvidersInfo) (e *api_server.Endpoint) {
+	e = api_server.GET(proto.V1Providers, &providersGetProcessor{
+		fn: fn,
+	})
+	return
+}
+
+type providersGetProcessor struct {
+	fn func() proto.ProvidersInfo
+}
+
+func (p *providersGetProcessor) Empty() interface{} {
+	return nil
+}
+
+func (p *providersGetProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	res = p.fn()
+	return
+}
+
+// NewResourcesGet returns resources with allocation states on agent
+func NewResourcesGet(fn func() proto.ResourcesInfo) (e *api_server.Endpoint) {
+	e = api_server.GET(proto.V1Resources, &resourcesGetProcessor{
+		fn: fn,
+	})
+	return
+}
+
+type resourcesGetProcessor struct {
+	fn func() proto.ResourcesInfo
+}
+
+func (p *resourcesGetProcessor) Empty() interface{} {
+	return nil
+}
+
+func (p *resourcesGetProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	res = p.fn()
+	return
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+	"github.com/da-moon/soil/agent/api/api-server"
+	"github.com/da-moon/soil/proto"
+	"net/url"
+)
+
+// NewStatusNodeGet returns status of agent which accepts request
+func NewStatusNodeGet(fn func() proto.NodeStatus) (e *api_server.Endpoint) {
+	e = api_server.GET(proto.V1StatusNode, &statusNodeGetProcessor{
+		fn: fn,
+	})
+	return
+}
+
+type statusNodeGetProcessor struct {
+	fn func() proto.NodeStatus
+}
+
+func (p *statusNodeGetProcessor) Empty() interface{} {
+	return nil
+}
+
+func (p *statusNodeGetProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	res = p.fn()
+	return
+}
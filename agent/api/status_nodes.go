@@ -11,8 +11,8 @@ import (
 )
 
 func NewClusterNodesGet(log *logx.Log) (e *api_server.Endpoint) {
-	return api_server.GET("/v1/status/nodes", &clusterNodesProcessor{
-		log: log.GetLog("api", "get", "/v1/status/nodes"),
+	return api_server.GET(proto.V1StatusNodes, &clusterNodesProcessor{
+		log: log.GetLog("api", "get", proto.V1StatusNodes),
 	})
 }
 
@@ -2,10 +2,11 @@ package api
 
 import (
 	"github.com/da-moon/soil/agent/api/api-server"
+	"github.com/da-moon/soil/proto"
 )
 
 func NewStatusPingGet() (e *api_server.Endpoint) {
-	return api_server.GET("/v1/status/ping", NewWrapper(func() (err error) {
+	return api_server.GET(proto.V1StatusPing, NewWrapper(func() (err error) {
 		return
 	}))
 }
@@ -44,3 +44,11 @@ func TestMessage_GetPayload(t *testing.T) {
 		"1": "1",
 	})
 }
+
+func TestMessage_StringRedactsSecrets(t *testing.T) {
+	msg := bus.NewMessage("test", map[string]string{
+		"value": "soil-secret:v1:aGVsbG8=",
+	})
+	assert.NotContains(t, msg.String(), "aGVsbG8=")
+	assert.Contains(t, msg.String(), "soil-secret:v1:<redacted>")
+}
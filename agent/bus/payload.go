@@ -3,6 +3,7 @@ package bus
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/da-moon/soil/manifest"
 	"hash/crc64"
 )
 
@@ -43,7 +44,8 @@ func (p Payload) Unmarshal(v interface{}) error {
 	return json.Unmarshal(p.data, v)
 }
 
+// String returns payload data with redacted secrets
 func (p Payload) String() (res string) {
-	res = fmt.Sprintf("%s(%d)", string(p.data), p.Hash())
+	res = fmt.Sprintf("%s(%d)", manifest.RedactSecrets(string(p.data)), p.Hash())
 	return
 }
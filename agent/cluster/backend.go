@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/akaspin/logx"
 	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/manifest"
 	"io"
 	"net/url"
 	"time"
@@ -33,6 +34,16 @@ type WatchResult struct {
 	Data map[string][]byte
 }
 
+// String returns watch result with redacted secrets
+func (r WatchResult) String() (res string) {
+	data := make(map[string]string, len(r.Data))
+	for k, v := range r.Data {
+		data[k] = manifest.RedactSecrets(string(v))
+	}
+	res = fmt.Sprintf("%s:%v", r.Key, data)
+	return
+}
+
 type Backend interface {
 	io.Closer
 
@@ -44,6 +55,13 @@ type Backend interface {
 	CommitChan() chan []StoreCommit
 	WatchResultsChan() chan WatchResult
 	Leave() // Leave cluster
+
+	// Claim atomically acquires key tied to backend session. Claim returns
+	// false if key is acquired by another node. Key which is already
+	// acquired by this node with the same value is treated as owned.
+	// Claimed keys are released then session is expired.
+	Claim(key string, value []byte) (ok bool, err error)
+	Release(key string) (err error) // Release key claimed by node
 }
 
 type BackendFactory func(ctx context.Context, log *logx.Log, config Config) (c Backend, err error)
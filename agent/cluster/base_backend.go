@@ -2,9 +2,12 @@ package cluster
 
 import (
 	"context"
+	"errors"
 	"github.com/akaspin/logx"
 )
 
+var errClaimNotSupported = errors.New("claims are not supported by backend")
+
 type baseBackend struct {
 	log    *logx.Log
 	config BackendConfig
@@ -69,6 +72,16 @@ func (b *baseBackend) Leave() {
 	close(b.leaveChan)
 }
 
+func (b *baseBackend) Claim(key string, value []byte) (ok bool, err error) {
+	err = errClaimNotSupported
+	return
+}
+
+func (b *baseBackend) Release(key string) (err error) {
+	err = errClaimNotSupported
+	return
+}
+
 func (b *baseBackend) fail(err error) {
 	b.log.Error(err)
 	b.failCancel()
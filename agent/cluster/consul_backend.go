@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -54,6 +55,58 @@ func (b *ConsulBackend) Subscribe(req []WatchRequest) {
 	}
 }
 
+// Claim locks key with node session
+func (b *ConsulBackend) Claim(key string, value []byte) (ok bool, err error) {
+	ok, resp, _, err := b.conn.KV().Txn(api.KVTxnOps{
+		&api.KVTxnOp{
+			Verb:    api.KVLock,
+			Key:     NormalizeKey(b.config.Chroot, key),
+			Session: b.sessionID,
+			Value:   value,
+		},
+	}, (&api.QueryOptions{}).WithContext(b.ctx))
+	if err == nil && !ok && resp != nil {
+		b.log.Debugf(`claim %s rejected: %v`, key, resp.Errors)
+		ok, err = b.isOwned(key, value)
+	}
+	return
+}
+
+// isOwned returns true if key holds value and is locked by session of
+// this node left from previous run
+func (b *ConsulBackend) isOwned(key string, value []byte) (ok bool, err error) {
+	pair, _, err := b.conn.KV().Get(NormalizeKey(b.config.Chroot, key), (&api.QueryOptions{}).WithContext(b.ctx))
+	if err != nil || pair == nil || pair.Session == "" || !bytes.Equal(pair.Value, value) {
+		return
+	}
+	session, _, err := b.conn.Session().Info(pair.Session, (&api.QueryOptions{}).WithContext(b.ctx))
+	if err != nil || session == nil {
+		return
+	}
+	ok = session.Name == b.config.ID || session.Name == NormalizeKey(b.config.Chroot, b.config.ID)
+	return
+}
+
+// Release deletes key if it is locked by node session
+func (b *ConsulBackend) Release(key string) (err error) {
+	normalized := NormalizeKey(b.config.Chroot, key)
+	ok, resp, _, err := b.conn.KV().Txn(api.KVTxnOps{
+		&api.KVTxnOp{
+			Verb:    api.KVCheckSession,
+			Key:     normalized,
+			Session: b.sessionID,
+		},
+		&api.KVTxnOp{
+			Verb: api.KVDelete,
+			Key:  normalized,
+		},
+	}, (&api.QueryOptions{}).WithContext(b.ctx))
+	if err == nil && !ok && resp != nil {
+		b.log.Debugf(`release %s skipped: %v`, key, resp.Errors)
+	}
+	return
+}
+
 func (b *ConsulBackend) loop() {
 	b.log.Debug(`open`)
 	select {
@@ -2,16 +2,31 @@ package cluster
 
 import (
 	"context"
+	"errors"
 	"github.com/akaspin/logx"
 	"github.com/akaspin/supervisor"
 	"github.com/da-moon/soil/agent/bus"
 )
 
+var errBackendNotReady = errors.New("backend is not ready")
+
 type kvConfigRequest struct {
 	config   Config
 	internal bool
 }
 
+type claimRequest struct {
+	key     string
+	value   []byte
+	release bool
+	resChan chan claimResult
+}
+
+type claimResult struct {
+	ok  bool
+	err error
+}
+
 type operatorConsumer struct {
 	kv       *KV
 	log      *logx.Log
@@ -55,6 +70,8 @@ type KV struct {
 	commitsChan       chan []StoreCommit
 	invokePendingChan chan struct{} // invoke pending operations
 
+	claimRequestsChan chan claimRequest
+
 	registerWatchChan chan WatchRequest
 	watchResultsChan  chan WatchResult
 
@@ -78,6 +95,7 @@ func NewKV(ctx context.Context, log *logx.Log, factory BackendFactory) (b *KV) {
 		commitsChan:       make(chan []StoreCommit, 1),
 		watchResultsChan:  make(chan WatchResult, 1),
 		invokePendingChan: make(chan struct{}, 1),
+		claimRequestsChan: make(chan claimRequest),
 
 		watchGroups:          map[string]*watchGroup{},
 		pendingWatchGroups:   map[string]struct{}{},
@@ -141,6 +159,50 @@ func (k *KV) Submit(ops []StoreOp) {
 	}
 }
 
+// Claim atomically acquires key in cluster. Claimed keys are tied to node
+// session and released then node leaves cluster. Claim returns false if key
+// is already acquired by another node and error if backend is not ready.
+// Key acquired by this node with the same value is treated as owned.
+func (k *KV) Claim(key string, value []byte) (ok bool, err error) {
+	var res claimResult
+	res, err = k.claim(claimRequest{
+		key:   key,
+		value: value,
+	})
+	if err == nil {
+		ok, err = res.ok, res.err
+	}
+	return
+}
+
+// Release releases key claimed by node
+func (k *KV) Release(key string) (err error) {
+	var res claimResult
+	if res, err = k.claim(claimRequest{
+		key:     key,
+		release: true,
+	}); err == nil {
+		err = res.err
+	}
+	return
+}
+
+func (k *KV) claim(req claimRequest) (res claimResult, err error) {
+	req.resChan = make(chan claimResult, 1)
+	select {
+	case <-k.Control.Ctx().Done():
+		err = k.Control.Ctx().Err()
+		return
+	case k.claimRequestsChan <- req:
+	}
+	select {
+	case <-k.Control.Ctx().Done():
+		err = k.Control.Ctx().Err()
+	case res = <-req.resChan:
+	}
+	return
+}
+
 // Subscribe for changes
 func (k *KV) SubscribeKey(key string, ctx context.Context, consumer bus.Consumer) {
 	select {
@@ -311,6 +373,28 @@ LOOP:
 				continue LOOP
 			}
 			k.log.Warningf(`watch group %s is not found`, result.Key)
+		case req := <-k.claimRequestsChan:
+			select {
+			case <-k.backend.ReadyCtx().Done():
+			default:
+				req.resChan <- claimResult{err: errBackendNotReady}
+				continue LOOP
+			}
+			select {
+			case <-k.backend.Ctx().Done():
+				req.resChan <- claimResult{err: errBackendNotReady}
+				continue LOOP
+			default:
+			}
+			go func(backend Backend) {
+				var res claimResult
+				if req.release {
+					res.err = backend.Release(req.key)
+				} else {
+					res.ok, res.err = backend.Claim(req.key, req.value)
+				}
+				req.resChan <- res
+			}(k.backend)
 		case id := <-k.closedWatchGroupChan:
 			delete(k.watchGroups, id)
 		}
@@ -7,6 +7,7 @@ import (
 	"github.com/akaspin/logx"
 	"github.com/da-moon/soil/agent/bus"
 	"net/url"
+	"sync"
 )
 
 type TestingBackendConfig struct {
@@ -14,6 +15,7 @@ type TestingBackendConfig struct {
 	ReadyChan   chan struct{}                          // ready channel
 	CrashChan   chan struct{}                          // Crash channel
 	MessageChan chan map[string]map[string]interface{} // Messages
+	Foreign     []string                               // Keys claimed by other nodes
 }
 
 func NewTestingBackendFactory(backendConfig TestingBackendConfig) (f BackendFactory) {
@@ -50,12 +52,16 @@ func NewTestingBackendFactory(backendConfig TestingBackendConfig) (f BackendFact
 type TestingBackend struct {
 	*baseBackend
 	config TestingBackendConfig
+
+	claimsMu sync.Mutex
+	claims   map[string][]byte
 }
 
 func NewTestingBackend(ctx context.Context, log *logx.Log, config TestingBackendConfig) (b *TestingBackend) {
 	b = &TestingBackend{
 		baseBackend: newBaseBackend(ctx, log, BackendConfig{}),
 		config:      config,
+		claims:      map[string][]byte{},
 	}
 	go func() {
 		select {
@@ -137,3 +143,23 @@ func (b *TestingBackend) Subscribe(requests []WatchRequest) {
 		b.log.Tracef(`subscribe: %s`, req.Key)
 	}
 }
+
+func (b *TestingBackend) Claim(key string, value []byte) (ok bool, err error) {
+	for _, foreign := range b.config.Foreign {
+		if foreign == key {
+			return
+		}
+	}
+	b.claimsMu.Lock()
+	defer b.claimsMu.Unlock()
+	b.claims[key] = value
+	ok = true
+	return
+}
+
+func (b *TestingBackend) Release(key string) (err error) {
+	b.claimsMu.Lock()
+	defer b.claimsMu.Unlock()
+	delete(b.claims, key)
+	return
+}
@@ -11,8 +11,16 @@ import (
 
 // Agent - specific config
 type Config struct {
-	Meta   map[string]string `hcl:"meta" json:"meta"`
-	System map[string]string `hcl:"system" json:"system"`
+	Meta      map[string]string `hcl:"meta" json:"meta"`
+	System    map[string]string `hcl:"system" json:"system"`
+	SecretKey string            `hcl:"secret_key" json:"-"` // Base64 encoded private key to decrypt pod secrets
+	Drift     DriftConfig       `hcl:"drift" json:"drift"`
+}
+
+// Drift reconciler config
+type DriftConfig struct {
+	Interval string `hcl:"interval" json:"interval,omitempty"` // Check interval
+	Policy   string `hcl:"policy" json:"policy,omitempty"`     // "report" or "repair"
 }
 
 func DefaultConfig() (c *Config) {
@@ -0,0 +1,74 @@
+package provision
+
+import (
+	"sort"
+	"time"
+
+	"github.com/da-moon/soil/agent/allocation"
+)
+
+const (
+	DriftPolicyReport = "report" // Only report drift
+	DriftPolicyRepair = "repair" // Report and repair drift
+
+	defaultDriftInterval = time.Minute
+)
+
+// DriftConfig configures drift reconciler
+type DriftConfig struct {
+	Interval time.Duration // Check interval. Default is one minute
+	Policy   string        // "report" or "repair". Default is "report"
+}
+
+func (c DriftConfig) interval() (res time.Duration) {
+	res = c.Interval
+	if res <= 0 {
+		res = defaultDriftInterval
+	}
+	return
+}
+
+// Drift returns paths of pod unit, units, drop-ins and blobs which differ
+// between expected and actual allocations.
+func Drift(expected, actual *allocation.Pod) (res []string) {
+	if expected.UnitFile.Source != actual.UnitFile.Source {
+		res = append(res, expected.UnitFile.Path)
+	}
+	actualUnits := map[string]*allocation.Unit{}
+	for _, u := range actual.Units {
+		actualUnits[u.UnitFile.Path] = u
+	}
+	for _, u := range expected.Units {
+		a, ok := actualUnits[u.UnitFile.Path]
+		if !ok {
+			continue
+		}
+		if u.UnitFile.Source != a.UnitFile.Source {
+			res = append(res, u.UnitFile.Path)
+		}
+		actualDropIns := map[string]string{}
+		for _, d := range a.DropIns {
+			actualDropIns[d.Path] = d.Source
+		}
+		for _, d := range u.DropIns {
+			if d.Source != actualDropIns[d.Path] {
+				res = append(res, d.Path)
+			}
+		}
+	}
+	actualBlobs := map[string]*allocation.Blob{}
+	for _, b := range actual.Blobs {
+		actualBlobs[b.Name] = b
+	}
+	for _, b := range expected.Blobs {
+		a, ok := actualBlobs[b.Name]
+		if !ok {
+			continue
+		}
+		if b.Source != a.Source || b.Digest != a.Digest {
+			res = append(res, b.Name)
+		}
+	}
+	sort.Strings(res)
+	return
+}
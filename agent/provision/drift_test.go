@@ -0,0 +1,60 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package provision_test
+
+import (
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/provision"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-drift")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pod := &allocation.Pod{
+		UnitFile: allocation.UnitFile{
+			SystemPaths: allocation.SystemPaths{
+				Local:   filepath.Join(dir, "etc"),
+				Runtime: filepath.Join(dir, "run"),
+			},
+		},
+	}
+	assert.NoError(t, pod.FromManifest(&manifest.Pod{
+		Namespace: "private",
+		Name:      "pod-1",
+		Runtime:   true,
+		Target:    "multi-user.target",
+		Units: manifest.Units{
+			{
+				Name:       "unit-1.service",
+				Source:     "[Service]\nExecStart=/usr/bin/sleep inf\n",
+				Transition: manifest.Transition{Create: "start", Update: "restart", Destroy: "stop"},
+			},
+		},
+		Blobs: manifest.Blobs{
+			{Name: filepath.Join(dir, "blob"), Permissions: 0644, Source: "blob"},
+		},
+	}, map[string]string{}))
+	assert.NoError(t, pod.UnitFile.Write())
+	assert.NoError(t, pod.Units[0].UnitFile.Write())
+	assert.NoError(t, pod.Blobs[0].Write())
+
+	t.Run(`0 no drift`, func(t *testing.T) {
+		assert.Empty(t, provision.Drift(pod, pod.Actual()))
+	})
+	t.Run(`1 drift`, func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(pod.Units[0].UnitFile.Path, []byte("[Service]\nExecStart=/bin/false\n"), 0644))
+		assert.NoError(t, os.Remove(pod.Blobs[0].Name))
+		actual := pod.Actual()
+		assert.Equal(t, []string{filepath.Join(dir, "blob"), pod.Units[0].UnitFile.Path}, provision.Drift(pod, actual))
+		assert.Equal(t, "[3:write-blob:"+filepath.Join(dir, "blob")+" 3:write-unit:"+pod.Units[0].UnitFile.Path+" 4:disable-unit:"+pod.Units[0].UnitFile.Path+" 5:restart:"+pod.Units[0].UnitFile.Path+"]", provision.NewEvaluation(actual, pod).Explain())
+	})
+}
@@ -3,6 +3,7 @@ package provision
 import (
 	"fmt"
 	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/manifest"
 	"sort"
 )
 
@@ -130,41 +131,110 @@ func planUnit(left, right *allocation.Unit) (res []Instruction) {
 	}
 
 	if left == nil {
-		res = planUnitDeploy(right.UnitFile, right.Permanent, right.Transition.Create)
+		res = append(res, planDropIns(nil, right.DropIns)...)
+		res = append(res, planUnitDeploy(right, right.Transition.Create)...)
 		return
 	}
-	if left.UnitFile.Path != right.UnitFile.Path {
-		// unit path changed: generate destroy/create
+	if left.UnitFile.Path != right.UnitFile.Path || left.Foreign != right.Foreign || left.Transient != right.Transient {
+		// unit path, ownership or mode changed: generate destroy/create
 		res = append(res, planUnitDestroy(left)...)
-		res = append(res, planUnitDeploy(right.UnitFile, right.Permanent, right.Transition.Create)...)
+		res = append(res, planDropIns(nil, right.DropIns)...)
+		res = append(res, planUnitDeploy(right, right.Transition.Create)...)
 		return
 	}
+	dropIns := planDropIns(left.DropIns, right.DropIns)
+	res = append(res, dropIns...)
 	if left.UnitFile.Source != right.UnitFile.Source {
-		res = planUnitDeploy(right.UnitFile, right.Permanent, right.Transition.Update)
+		if right.Transient {
+			// transient unit properties can be changed only by recreation
+			res = append(res, NewCommandInstruction(destroyCommandPhase(left), left.UnitFile, "stop"))
+		}
+		res = append(res, planUnitDeploy(right, right.Transition.Update)...)
 		return
 	}
+	if len(dropIns) > 0 && right.Transition.Update != "" {
+		res = append(res, NewCommandInstruction(deployCommandPhase(right), right.UnitFile, right.Transition.Update))
+	}
 	// just permanency check
-	if left.Permanent != right.Permanent {
+	if left.Permanent != right.Permanent && !right.Foreign && !right.Transient {
 		res = append(res, planUnitPerm(right.UnitFile, right.Permanent))
 	}
 
 	return
 }
 
+// planUnitDestroy removes unit drop-ins. Unit itself is stopped and removed
+// only if it is managed by pod. Transient units have no files to remove.
 func planUnitDestroy(what *allocation.Unit) (res []Instruction) {
-	res = []Instruction{
-		NewDeleteUnitInstruction(what.UnitFile),
+	res = planDropIns(what.DropIns, nil)
+	if what.Foreign {
+		return
+	}
+	if !what.Transient {
+		res = append(res, NewDeleteUnitInstruction(what.UnitFile))
 	}
 	if what.Transition.Destroy != "" {
-		res = append(res, NewCommandInstruction(phaseDestroyCommand, what.UnitFile, what.Transition.Destroy))
+		res = append(res, NewCommandInstruction(destroyCommandPhase(what), what.UnitFile, what.Transition.Destroy))
 	}
 	return
 }
 
-func planUnitDeploy(what allocation.UnitFile, permanent bool, command string) (res []Instruction) {
-	res = append(res, NewWriteUnitInstruction(what), planUnitPerm(what, permanent))
+// planUnitDeploy writes and starts unit. Transient units are always created
+// on deploy regardless of command.
+func planUnitDeploy(what *allocation.Unit, command string) (res []Instruction) {
+	if what.Transient {
+		res = append(res, NewStartTransientInstruction(deployCommandPhase(what), what))
+		return
+	}
+	if !what.Foreign {
+		res = append(res, NewWriteUnitInstruction(what.UnitFile), planUnitPerm(what.UnitFile, what.Permanent))
+	}
 	if command != "" {
-		res = append(res, NewCommandInstruction(phaseDeployCommand, what, command))
+		res = append(res, NewCommandInstruction(deployCommandPhase(what), what.UnitFile, command))
+	}
+	return
+}
+
+// destroyCommandPhase returns phase for destroy commands. Triggers are
+// stopped before activated units.
+func destroyCommandPhase(what *allocation.Unit) (res int) {
+	res = phaseDestroyCommand
+	if manifest.IsTrigger(what.UnitName()) {
+		res = phaseDestroyTriggers
+	}
+	return
+}
+
+// deployCommandPhase returns phase for create and update commands. Triggers
+// are started after all activated units are deployed.
+func deployCommandPhase(what *allocation.Unit) (res int) {
+	res = phaseDeployCommand
+	if manifest.IsTrigger(what.UnitName()) {
+		res = phaseDeployTriggers
+	}
+	return
+}
+
+func planDropIns(left, right []*allocation.DropIn) (res []Instruction) {
+	candidates := map[string]*allocation.DropIn{}
+	for _, d := range right {
+		candidates[d.Path] = d
+	}
+	for _, d := range left {
+		candidate, ok := candidates[d.Path]
+		if !ok {
+			res = append(res, NewDeleteDropInInstruction(d))
+			continue
+		}
+		if candidate.Source != d.Source {
+			res = append(res, NewWriteDropInInstruction(candidate))
+		}
+		delete(candidates, d.Path)
+	}
+	for _, d := range right {
+		if _, ok := candidates[d.Path]; ok {
+			res = append(res, NewWriteDropInInstruction(d))
+		}
 	}
 	return
 }
@@ -193,8 +263,48 @@ func PlanBlob(left, right *allocation.Blob) (res []Instruction) {
 		return
 	}
 	// ok we have two blobs
-	if left.Source != right.Source || left.Permissions != right.Permissions {
+	if left.Kind != right.Kind {
+		// file can not be replaced by directory and vice versa in place
+		res = append(res,
+			NewDestroyBlobInstruction(phaseDestroyUnits, left),
+			NewWriteBlobInstruction(phaseDeployFS, right))
+		return
+	}
+	if right.IsArchive() {
+		res = append(res, planArchive(left, right)...)
+		return
+	}
+	if left.Source != right.Source ||
+		left.Permissions != right.Permissions ||
+		left.DirPermissions != right.DirPermissions ||
+		left.Owner != right.Owner ||
+		left.Group != right.Group ||
+		left.SHA256 != right.SHA256 {
 		res = append(res, NewWriteBlobInstruction(phaseDeployFS, right))
 	}
 	return
 }
+
+func planArchive(left, right *allocation.Blob) (res []Instruction) {
+	if left.Digest != right.Digest ||
+		left.DirPermissions != right.DirPermissions ||
+		left.Owner != right.Owner ||
+		left.Group != right.Group ||
+		left.SHA256 != right.SHA256 {
+		res = append(res, NewWriteBlobInstruction(phaseDeployFS, right))
+	}
+	extracted := map[string]struct{}{}
+	for _, path := range right.Paths {
+		extracted[path] = struct{}{}
+	}
+	var stale []string
+	for _, path := range left.Paths {
+		if _, ok := extracted[path]; !ok {
+			stale = append(stale, path)
+		}
+	}
+	if len(stale) > 0 {
+		res = append(res, NewDeleteBlobPathsInstruction(phaseDestroyBlobs, right, stale))
+	}
+	return
+}
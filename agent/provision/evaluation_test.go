@@ -4,7 +4,9 @@
 package provision_test
 
 import (
+	"github.com/da-moon/soil/agent/allocation"
 	"github.com/da-moon/soil/agent/provision"
+	"github.com/da-moon/soil/manifest"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -20,29 +22,112 @@ func TestEvaluation_Plan(t *testing.T) {
 	t.Run("1 - unit-1 perm to disabled", func(t *testing.T) {
 		right := makeAllocations(t, "testdata/evaluation_test_1_right.hcl")[0]
 		evaluation := provision.NewEvaluation(left1, right)
-		assert.Equal(t, "[2:write-unit:/etc/systemd/system/pod-private-pod-1.service 3:disable-unit:/etc/systemd/system/unit-1.service 3:enable-unit:/etc/systemd/system/pod-private-pod-1.service 4:restart:/etc/systemd/system/pod-private-pod-1.service]", evaluation.Explain())
+		assert.Equal(t, "[3:write-unit:/etc/systemd/system/pod-private-pod-1.service 4:disable-unit:/etc/systemd/system/unit-1.service 4:enable-unit:/etc/systemd/system/pod-private-pod-1.service 5:restart:/etc/systemd/system/pod-private-pod-1.service]", evaluation.Explain())
 	})
 	t.Run("2 - update unit-1 and file", func(t *testing.T) {
 		right := makeAllocations(t, "testdata/evaluation_test_2_right.hcl")[0]
 		evaluation := provision.NewEvaluation(left1, right)
-		assert.Equal(t, "[2:write-blob:/etc/test1 2:write-unit:/etc/systemd/system/pod-private-pod-1.service 2:write-unit:/etc/systemd/system/unit-1.service 3:enable-unit:/etc/systemd/system/pod-private-pod-1.service 3:enable-unit:/etc/systemd/system/unit-1.service 4:restart:/etc/systemd/system/pod-private-pod-1.service 4:restart:/etc/systemd/system/unit-1.service]", evaluation.Explain())
+		assert.Equal(t, "[3:write-blob:/etc/test1 3:write-unit:/etc/systemd/system/pod-private-pod-1.service 3:write-unit:/etc/systemd/system/unit-1.service 4:enable-unit:/etc/systemd/system/pod-private-pod-1.service 4:enable-unit:/etc/systemd/system/unit-1.service 5:restart:/etc/systemd/system/pod-private-pod-1.service 5:restart:/etc/systemd/system/unit-1.service]", evaluation.Explain())
 	})
 	t.Run("3 - create pod form left", func(t *testing.T) {
 		evaluation := provision.NewEvaluation(nil, left1)
-		assert.Equal(t, "[2:write-blob:/etc/test1 2:write-unit:/etc/systemd/system/pod-private-pod-1.service 2:write-unit:/etc/systemd/system/unit-1.service 2:write-unit:/etc/systemd/system/unit-2.service 3:enable-unit:/etc/systemd/system/pod-private-pod-1.service 3:enable-unit:/etc/systemd/system/unit-1.service 3:enable-unit:/etc/systemd/system/unit-2.service 4:start:/etc/systemd/system/pod-private-pod-1.service 4:start:/etc/systemd/system/unit-1.service 4:start:/etc/systemd/system/unit-2.service]", evaluation.Explain())
+		assert.Equal(t, "[3:write-blob:/etc/test1 3:write-unit:/etc/systemd/system/pod-private-pod-1.service 3:write-unit:/etc/systemd/system/unit-1.service 3:write-unit:/etc/systemd/system/unit-2.service 4:enable-unit:/etc/systemd/system/pod-private-pod-1.service 4:enable-unit:/etc/systemd/system/unit-1.service 4:enable-unit:/etc/systemd/system/unit-2.service 5:start:/etc/systemd/system/pod-private-pod-1.service 5:start:/etc/systemd/system/unit-1.service 5:start:/etc/systemd/system/unit-2.service]", evaluation.Explain())
 	})
 	t.Run("4 - destroy pod", func(t *testing.T) {
 		evaluation := provision.NewEvaluation(left1, nil)
-		assert.Equal(t, "[0:stop:/etc/systemd/system/pod-private-pod-1.service 0:stop:/etc/systemd/system/unit-1.service 0:stop:/etc/systemd/system/unit-2.service 1:delete-unit:/etc/systemd/system/pod-private-pod-1.service 1:delete-unit:/etc/systemd/system/unit-1.service 1:delete-unit:/etc/systemd/system/unit-2.service 5:delete-blob:/etc/test1]", evaluation.Explain())
+		assert.Equal(t, "[1:stop:/etc/systemd/system/pod-private-pod-1.service 1:stop:/etc/systemd/system/unit-1.service 1:stop:/etc/systemd/system/unit-2.service 2:delete-unit:/etc/systemd/system/pod-private-pod-1.service 2:delete-unit:/etc/systemd/system/unit-1.service 2:delete-unit:/etc/systemd/system/unit-2.service 7:delete-blob:/etc/test1]", evaluation.Explain())
 	})
 	t.Run("5 - local to runtime", func(t *testing.T) {
 		right := makeAllocations(t, "testdata/evaluation_test_5_right.hcl")[0]
 		evaluation := provision.NewEvaluation(left1, right)
-		assert.Equal(t, "[0:stop:/etc/systemd/system/pod-private-pod-1.service 0:stop:/etc/systemd/system/unit-1.service 0:stop:/etc/systemd/system/unit-2.service 1:delete-unit:/etc/systemd/system/pod-private-pod-1.service 1:delete-unit:/etc/systemd/system/unit-1.service 1:delete-unit:/etc/systemd/system/unit-2.service 2:write-unit:/run/systemd/system/pod-private-pod-1.service 2:write-unit:/run/systemd/system/unit-1.service 2:write-unit:/run/systemd/system/unit-2.service 3:enable-unit:/run/systemd/system/pod-private-pod-1.service 3:enable-unit:/run/systemd/system/unit-1.service 3:enable-unit:/run/systemd/system/unit-2.service 4:start:/run/systemd/system/pod-private-pod-1.service 4:start:/run/systemd/system/unit-1.service 4:start:/run/systemd/system/unit-2.service]", evaluation.Explain())
+		assert.Equal(t, "[1:stop:/etc/systemd/system/pod-private-pod-1.service 1:stop:/etc/systemd/system/unit-1.service 1:stop:/etc/systemd/system/unit-2.service 2:delete-unit:/etc/systemd/system/pod-private-pod-1.service 2:delete-unit:/etc/systemd/system/unit-1.service 2:delete-unit:/etc/systemd/system/unit-2.service 3:write-unit:/run/systemd/system/pod-private-pod-1.service 3:write-unit:/run/systemd/system/unit-1.service 3:write-unit:/run/systemd/system/unit-2.service 4:enable-unit:/run/systemd/system/pod-private-pod-1.service 4:enable-unit:/run/systemd/system/unit-1.service 4:enable-unit:/run/systemd/system/unit-2.service 5:start:/run/systemd/system/pod-private-pod-1.service 5:start:/run/systemd/system/unit-1.service 5:start:/run/systemd/system/unit-2.service]", evaluation.Explain())
 	})
 	t.Run("6 destroy with no units", func(t *testing.T) {
 		left := makeAllocations(t, "testdata/evaluation_test_6_left.hcl")[0]
 		evaluation := provision.NewEvaluation(left, nil)
-		assert.Equal(t, "[0:stop:/run/systemd/system/pod-private-pod-1.service 1:delete-unit:/run/systemd/system/pod-private-pod-1.service]", evaluation.Explain())
+		assert.Equal(t, "[1:stop:/run/systemd/system/pod-private-pod-1.service 2:delete-unit:/run/systemd/system/pod-private-pod-1.service]", evaluation.Explain())
+	})
+	t.Run("7 drop-ins", func(t *testing.T) {
+		left := makeAllocations(t, "testdata/evaluation_test_7_left.hcl")[0]
+		right := makeAllocations(t, "testdata/evaluation_test_7_right.hcl")[0]
+		t.Run("create", func(t *testing.T) {
+			evaluation := provision.NewEvaluation(nil, left)
+			assert.Equal(t, "[3:write-dropin:/etc/systemd/system/docker.service.d/10-env.conf 3:write-dropin:/etc/systemd/system/docker.service.d/20-limits.conf 3:write-dropin:/etc/systemd/system/unit-1.service.d/10-env.conf 3:write-unit:/etc/systemd/system/pod-private-pod-1.service 3:write-unit:/etc/systemd/system/unit-1.service 4:enable-unit:/etc/systemd/system/pod-private-pod-1.service 4:enable-unit:/etc/systemd/system/unit-1.service 5:start:/etc/systemd/system/docker.service 5:start:/etc/systemd/system/pod-private-pod-1.service 5:start:/etc/systemd/system/unit-1.service]", evaluation.Explain())
+		})
+		t.Run("update drop-ins only", func(t *testing.T) {
+			evaluation := provision.NewEvaluation(left, right)
+			assert.Equal(t, "[2:delete-dropin:/etc/systemd/system/docker.service.d/20-limits.conf 3:write-dropin:/etc/systemd/system/docker.service.d/10-env.conf 3:write-unit:/etc/systemd/system/pod-private-pod-1.service 4:enable-unit:/etc/systemd/system/pod-private-pod-1.service 5:restart:/etc/systemd/system/docker.service 5:restart:/etc/systemd/system/pod-private-pod-1.service]", evaluation.Explain())
+		})
+		t.Run("destroy", func(t *testing.T) {
+			evaluation := provision.NewEvaluation(right, nil)
+			assert.Equal(t, "[1:stop:/etc/systemd/system/pod-private-pod-1.service 1:stop:/etc/systemd/system/unit-1.service 2:delete-dropin:/etc/systemd/system/docker.service.d/10-env.conf 2:delete-dropin:/etc/systemd/system/unit-1.service.d/10-env.conf 2:delete-unit:/etc/systemd/system/pod-private-pod-1.service 2:delete-unit:/etc/systemd/system/unit-1.service]", evaluation.Explain())
+		})
+	})
+	t.Run("8 triggers", func(t *testing.T) {
+		pod := makeAllocations(t, "testdata/evaluation_test_8.hcl")[0]
+		t.Run("create", func(t *testing.T) {
+			evaluation := provision.NewEvaluation(nil, pod)
+			assert.Equal(t, "[3:write-unit:/etc/systemd/system/backup.service 3:write-unit:/etc/systemd/system/backup.timer 3:write-unit:/etc/systemd/system/pod-private-pod-1.service 4:disable-unit:/etc/systemd/system/backup.service 4:disable-unit:/etc/systemd/system/backup.timer 4:enable-unit:/etc/systemd/system/pod-private-pod-1.service 5:start:/etc/systemd/system/pod-private-pod-1.service 6:start:/etc/systemd/system/backup.timer]", evaluation.Explain())
+		})
+		t.Run("destroy", func(t *testing.T) {
+			evaluation := provision.NewEvaluation(pod, nil)
+			assert.Equal(t, "[0:stop:/etc/systemd/system/backup.timer 1:stop:/etc/systemd/system/backup.service 1:stop:/etc/systemd/system/pod-private-pod-1.service 2:delete-unit:/etc/systemd/system/backup.service 2:delete-unit:/etc/systemd/system/backup.timer 2:delete-unit:/etc/systemd/system/pod-private-pod-1.service]", evaluation.Explain())
+		})
+	})
+	t.Run("9 transient", func(t *testing.T) {
+		left := makeAllocations(t, "testdata/evaluation_test_9.hcl")[0]
+		right := makeAllocations(t, "testdata/evaluation_test_9_right.hcl")[0]
+		t.Run("create", func(t *testing.T) {
+			evaluation := provision.NewEvaluation(nil, left)
+			assert.Equal(t, "[5:start-transient:/run/systemd/transient/job.service 5:start-transient:/run/systemd/transient/pod-private-pod-1.service 6:start-transient:/run/systemd/transient/job.timer]", evaluation.Explain())
+		})
+		t.Run("update", func(t *testing.T) {
+			evaluation := provision.NewEvaluation(left, right)
+			assert.Equal(t, "[1:stop:/run/systemd/transient/job.service 1:stop:/run/systemd/transient/pod-private-pod-1.service 5:start-transient:/run/systemd/transient/job.service 5:start-transient:/run/systemd/transient/pod-private-pod-1.service]", evaluation.Explain())
+		})
+		t.Run("destroy", func(t *testing.T) {
+			evaluation := provision.NewEvaluation(right, nil)
+			assert.Equal(t, "[0:stop:/run/systemd/transient/job.timer 1:stop:/run/systemd/transient/job.service 1:stop:/run/systemd/transient/pod-private-pod-1.service]", evaluation.Explain())
+		})
+	})
+}
+
+func TestPlanBlob_Archive(t *testing.T) {
+	explain := func(instructions []provision.Instruction) (res []string) {
+		for _, i := range instructions {
+			res = append(res, i.String())
+		}
+		return
+	}
+	left := &allocation.Blob{
+		Name:   "/srv/static",
+		Kind:   manifest.BlobKindArchive,
+		Paths:  []string{"css", "css/main.css", "index.html"},
+		Digest: "1",
+	}
+	t.Run("create", func(t *testing.T) {
+		assert.Equal(t, []string{"3:write-blob:/srv/static"}, explain(provision.PlanBlob(nil, left)))
+	})
+	t.Run("update", func(t *testing.T) {
+		right := &allocation.Blob{
+			Name:   "/srv/static",
+			Kind:   manifest.BlobKindArchive,
+			Paths:  []string{"index.html"},
+			Digest: "2",
+		}
+		assert.Equal(t, []string{"3:write-blob:/srv/static", "7:delete-blob-paths:/srv/static"}, explain(provision.PlanBlob(left, right)))
+	})
+	t.Run("noop", func(t *testing.T) {
+		assert.Empty(t, provision.PlanBlob(left, left))
+	})
+	t.Run("kind", func(t *testing.T) {
+		right := &allocation.Blob{
+			Name:   "/srv/static",
+			Source: "file",
+		}
+		assert.Equal(t, []string{"2:delete-blob:/srv/static", "3:write-blob:/srv/static"}, explain(provision.PlanBlob(left, right)))
+	})
+	t.Run("destroy", func(t *testing.T) {
+		assert.Equal(t, []string{"7:delete-blob:/srv/static"}, explain(provision.PlanBlob(left, nil)))
 	})
 }
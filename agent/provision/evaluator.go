@@ -3,7 +3,9 @@ package provision
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/akaspin/logx"
 	"github.com/akaspin/supervisor"
@@ -17,6 +19,7 @@ type EvaluatorConfig struct {
 	SystemPaths    allocation.SystemPaths
 	Recovery       allocation.PodSlice // recovery state
 	StatusConsumer bus.Consumer        // consumer for "evaluation.<pod>.*"
+	Store          *allocation.Store   // allocations store. Allocations are not persisted if not defined
 }
 
 type Evaluator struct {
@@ -25,6 +28,13 @@ type Evaluator struct {
 	config EvaluatorConfig
 
 	state *EvaluatorState
+
+	secretMu  sync.RWMutex
+	secretKey *manifest.SecretKey
+
+	driftMu     sync.RWMutex
+	driftConfig DriftConfig
+	drift       map[string][]string // Drifted paths by pod
 }
 
 func NewEvaluator(ctx context.Context, log *logx.Log, config EvaluatorConfig) (e *Evaluator) {
@@ -32,6 +42,7 @@ func NewEvaluator(ctx context.Context, log *logx.Log, config EvaluatorConfig) (e
 		Control: supervisor.NewControl(ctx),
 		log:     log.GetLog("provision", "evaluator"),
 		config:  config,
+		drift:   map[string][]string{},
 	}
 	e.state = NewEvaluatorState(e.log, config.Recovery)
 	return
@@ -46,6 +57,7 @@ func (e *Evaluator) Open() (err error) {
 		}
 	}
 	e.config.StatusConsumer.ConsumeMessage(bus.NewMessage("", resetData))
+	go e.driftLoop()
 	err = e.Control.Open()
 	return
 }
@@ -63,12 +75,57 @@ func (e *Evaluator) GetConstraint(pod *manifest.Pod) (res manifest.Constraint) {
 	return
 }
 
-func (e *Evaluator) Allocate(pod *manifest.Pod, env map[string]string) {
+// SetDriftConfig sets drift reconciler configuration
+func (e *Evaluator) SetDriftConfig(config DriftConfig) {
+	e.driftMu.Lock()
+	defer e.driftMu.Unlock()
+	e.driftConfig = config
+}
+
+// Drift returns drifted paths by pod found by last reconciliation
+func (e *Evaluator) Drift() (res map[string][]string) {
+	e.driftMu.RLock()
+	defer e.driftMu.RUnlock()
+	res = make(map[string][]string, len(e.drift))
+	for name, paths := range e.drift {
+		res[name] = append([]string{}, paths...)
+	}
+	return
+}
+
+// SetSecretKey sets key to decrypt pod secrets on allocation
+func (e *Evaluator) SetSecretKey(key *manifest.SecretKey) {
+	e.secretMu.Lock()
+	defer e.secretMu.Unlock()
+	e.secretKey = key
+}
 
+// IsActive returns true if units of deployed pod are active
+func (e *Evaluator) IsActive(name string) (ok bool) {
+	pod := e.state.Finished(name)
+	if pod == nil {
+		return
+	}
+	var err error
+	if ok, err = pod.IsActive(); err != nil {
+		e.log.Warningf(`can't check units of %s: %v`, name, err)
+	}
+	return
+}
+
+func (e *Evaluator) Allocate(pod *manifest.Pod, env map[string]string) {
+	e.secretMu.RLock()
+	key := e.secretKey
+	e.secretMu.RUnlock()
+	if len(pod.Secrets) > 0 && key == nil {
+		e.log.Errorf(`skip allocate %s: secret key is not configured`, pod.Name)
+		return
+	}
 	alloc := &allocation.Pod{
 		UnitFile: allocation.UnitFile{
 			SystemPaths: e.config.SystemPaths,
 		},
+		SecretKey: key,
 	}
 	if err := alloc.FromManifest(pod, env); err != nil {
 		e.log.Error(err)
@@ -97,15 +154,37 @@ func (e *Evaluator) fanOut(next []*Evaluation) {
 func (e *Evaluator) executeEvaluation(evaluation *Evaluation) {
 	var failures []error
 	e.log.Tracef("begin: %s", evaluation)
-	conn, err := dbus.New()
-	if err != nil {
-		e.log.Error(err)
-		return
+	name := evaluation.Name()
+	conns := map[string]*dbus.Conn{}
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for _, pod := range []*allocation.Pod{evaluation.Left, evaluation.Right} {
+		if pod == nil {
+			continue
+		}
+		if _, ok := conns[pod.SystemPaths.User]; ok {
+			continue
+		}
+		conn, err := allocation.NewSystemdConn(pod.SystemPaths.User)
+		if err != nil {
+			// nothing is applied but evaluation should be committed to
+			// not block pending evaluations of the same pod
+			e.log.Errorf("evaluation failed: %s: %v", evaluation, err)
+			e.config.StatusConsumer.ConsumeMessage(bus.NewMessage(name, map[string]string{
+				"present": "true",
+				"state":   "failed",
+			}))
+			e.forgetDrift(name)
+			e.fanOut(e.state.Commit(name))
+			return
+		}
+		conns[pod.SystemPaths.User] = conn
 	}
-	defer conn.Close()
 
 	plan := evaluation.Plan()
-	name := evaluation.Name()
 	var phase []Instruction
 	currentPhase := -1
 
@@ -123,12 +202,12 @@ func (e *Evaluator) executeEvaluation(evaluation *Evaluation) {
 	for _, instruction := range plan {
 		if currentPhase < instruction.Phase() {
 			currentPhase = instruction.Phase()
-			failures = append(failures, e.executePhase(phase, conn)...)
+			failures = append(failures, e.executePhase(phase, conns)...)
 			phase = []Instruction{}
 		}
 		phase = append(phase, instruction)
 	}
-	failures = append(failures, e.executePhase(phase, conn)...)
+	failures = append(failures, e.executePhase(phase, conns)...)
 
 	e.log.Debugf("plan done: %s:%s (failures:%v)", evaluation, plan, failures)
 	e.log.Infof("evaluation done: %s (failures:%v)", evaluation, failures)
@@ -141,12 +220,96 @@ func (e *Evaluator) executeEvaluation(evaluation *Evaluation) {
 		e.config.StatusConsumer.ConsumeMessage(bus.NewMessage(evaluation.Name(), nil))
 	}
 
+	e.persist(evaluation)
+	e.forgetDrift(name)
 	next := e.state.Commit(evaluation.Name())
 	e.fanOut(next)
 
 }
 
-func (e *Evaluator) executePhase(phase []Instruction, conn *dbus.Conn) (failures []error) {
+// persist stores evaluated allocation
+func (e *Evaluator) persist(evaluation *Evaluation) {
+	if e.config.Store == nil {
+		return
+	}
+	var err error
+	if evaluation.Right == nil {
+		err = e.config.Store.Delete(evaluation.Name())
+	} else {
+		err = e.config.Store.Put(evaluation.Right)
+	}
+	if err != nil {
+		e.log.Errorf(`persist %s: %v`, evaluation.Name(), err)
+	}
+}
+
+func (e *Evaluator) driftLoop() {
+	for {
+		e.driftMu.RLock()
+		interval := e.driftConfig.interval()
+		e.driftMu.RUnlock()
+		select {
+		case <-e.Control.Ctx().Done():
+			return
+		case <-time.After(interval):
+			e.fanOut(e.reconcile())
+		}
+	}
+}
+
+// reconcile compares finished allocations with filesystem and reports
+// drift. Evaluations to repair drift are returned if policy is "repair".
+// Filesystem is read without holding evaluator state.
+func (e *Evaluator) reconcile() (next []*Evaluation) {
+	e.driftMu.RLock()
+	policy := e.driftConfig.Policy
+	e.driftMu.RUnlock()
+	for name, pod := range e.state.Idle() {
+		if pod == nil {
+			continue
+		}
+		actual := pod.Actual()
+		paths := Drift(pod, actual)
+		next = append(next, e.state.Reconcile(name, pod, func() (repair *Evaluation) {
+			e.driftMu.Lock()
+			defer e.driftMu.Unlock()
+			reported := strings.Join(e.drift[name], ",")
+			if len(paths) == 0 {
+				delete(e.drift, name)
+			} else {
+				e.drift[name] = paths
+				e.log.Warningf(`drift detected in %s: %v`, name, paths)
+				if policy == DriftPolicyRepair {
+					repair = NewEvaluation(actual, pod)
+					return
+				}
+			}
+			if strings.Join(paths, ",") == reported {
+				return
+			}
+			status := map[string]string{
+				"present": "true",
+				"state":   "done",
+			}
+			if len(paths) > 0 {
+				status["drift"] = strings.Join(paths, ",")
+			}
+			e.config.StatusConsumer.ConsumeMessage(bus.NewMessage(name, status))
+			return
+		})...)
+	}
+	return
+}
+
+// forgetDrift clears reported drift of pod. Evaluation publishes status
+// without drift, so drift should be reported again if it is still present.
+func (e *Evaluator) forgetDrift(name string) {
+	e.driftMu.Lock()
+	defer e.driftMu.Unlock()
+	delete(e.drift, name)
+}
+
+func (e *Evaluator) executePhase(phase []Instruction, conns map[string]*dbus.Conn) (failures []error) {
 	if len(phase) == 0 {
 		return
 	}
@@ -159,7 +322,7 @@ func (e *Evaluator) executePhase(phase []Instruction, conn *dbus.Conn) (failures
 			defer wg.Done()
 			e.log.Tracef("begin instruction %v", instruction)
 			var iErr error
-			if iErr = instruction.Execute(conn); iErr != nil {
+			if iErr = instruction.Execute(conns[instructionUser(instruction)]); iErr != nil {
 				e.log.Errorf("error while execute instruction %v: %s", instruction, iErr)
 			}
 			e.log.Tracef("finish instruction %s", instruction)
@@ -58,6 +58,56 @@ func (s *EvaluatorState) Commit(name string) (next []*Evaluation) {
 	return
 }
 
+// Finished returns finished allocation by name
+func (s *EvaluatorState) Finished(name string) (pod *allocation.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pod = s.finished[name]
+	return
+}
+
+// Idle returns snapshot of finished allocations which are not in progress
+// or pending
+func (s *EvaluatorState) Idle() (res map[string]*allocation.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res = map[string]*allocation.Pod{}
+	for name, pod := range s.finished {
+		if _, ok := s.inProgress[name]; ok {
+			continue
+		}
+		if _, ok := s.pending[name]; ok {
+			continue
+		}
+		res[name] = pod
+	}
+	return
+}
+
+// Reconcile calls function if given allocation is still finished and is not
+// in progress or pending. Evaluation returned by function is promoted to in
+// progress and returned to execute.
+func (s *EvaluatorState) Reconcile(name string, pod *allocation.Pod, fn func() *Evaluation) (next []*Evaluation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if finished, ok := s.finished[name]; !ok || finished != pod {
+		s.log.Tracef(`skip reconcile %s: changed`, name)
+		return
+	}
+	if _, ok := s.inProgress[name]; ok {
+		return
+	}
+	if _, ok := s.pending[name]; ok {
+		return
+	}
+	if evaluation := fn(); evaluation != nil {
+		s.inProgress[name] = pod
+		next = append(next, evaluation)
+		s.log.Tracef(`%s promoted to in progress by reconcile`, name)
+	}
+	return
+}
+
 func (s *EvaluatorState) next() (next []*Evaluation) {
 LOOP:
 	for pendingName, pending := range s.pending {
@@ -53,3 +53,28 @@ func TestEvaluatorState_Submit(t *testing.T) {
 		assert.Len(t, next, 1, "pod-1 should be evaluated")
 	})
 }
+
+func TestEvaluatorState_Reconcile(t *testing.T) {
+	recovered := makeAllocations(t, "testdata/evaluator_state_test_0.hcl")
+	state := provision.NewEvaluatorState(logx.GetLog("test"), recovered)
+	next := state.Submit("pod-1", makeAllocations(t, "testdata/evaluator_state_test_4.hcl")[0])
+	assert.Len(t, next, 1)
+
+	idle := state.Idle()
+	assert.NotContains(t, idle, "pod-1", "pod-1 in progress should be skipped")
+	assert.Len(t, idle, len(recovered)-1)
+
+	// pod-1 is changed after snapshot
+	assert.Empty(t, state.Reconcile("pod-1", recovered[0], func() (repair *provision.Evaluation) {
+		t.Error("pod-1 should be in progress")
+		return
+	}))
+	for name, pod := range idle {
+		next = state.Reconcile(name, pod, func() (repair *provision.Evaluation) {
+			repair = provision.NewEvaluation(pod, pod)
+			return
+		})
+		assert.Len(t, next, 1)
+	}
+	assert.Empty(t, state.Idle())
+}
@@ -8,12 +8,14 @@ import (
 )
 
 const (
-	phaseDestroyCommand = iota // execute unit commands on destroy
-	phaseDestroyUnits          // Destroy units from filesystem
-	phaseDeployFS              // Write units to filesystem
-	phaseDeployPerm            // Enable or disable units
-	phaseDeployCommand         // Execute create/modify unit commands
-	phaseDestroyBlobs          // Destroy blobs from filesystem
+	phaseDestroyTriggers = iota // execute trigger unit commands on destroy
+	phaseDestroyCommand         // execute unit commands on destroy
+	phaseDestroyUnits           // Destroy units from filesystem
+	phaseDeployFS               // Write units to filesystem
+	phaseDeployPerm             // Enable or disable units
+	phaseDeployCommand          // Execute create/modify unit commands
+	phaseDeployTriggers         // Execute create/modify trigger unit commands
+	phaseDestroyBlobs           // Destroy blobs from filesystem
 )
 
 // Instruction represents one atomic instruction bounded to specific phase
@@ -23,6 +25,15 @@ type Instruction interface {
 	String() string
 }
 
+// instructionUser returns owner of systemd user instance for instructions
+// bounded to unit or empty string for system instance
+func instructionUser(instruction Instruction) (res string) {
+	if v, ok := instruction.(interface{ User() string }); ok {
+		res = v.User()
+	}
+	return
+}
+
 type baseUnitInstruction struct {
 	phase    int
 	explain  string
@@ -41,6 +52,10 @@ func (i *baseUnitInstruction) Phase() int {
 	return i.phase
 }
 
+func (i *baseUnitInstruction) User() string {
+	return i.unitFile.SystemPaths.User
+}
+
 func (i *baseUnitInstruction) String() string {
 	return fmt.Sprintf("%d:%s:%s", i.phase, i.explain, i.unitFile.Path)
 }
@@ -147,6 +162,70 @@ func (i *CommandInstruction) Execute(conn *dbus.Conn) (err error) {
 	return
 }
 
+type baseDropInInstruction struct {
+	phase   int
+	explain string
+	dropIn  *allocation.DropIn
+}
+
+func (i *baseDropInInstruction) Phase() int {
+	return i.phase
+}
+
+func (i *baseDropInInstruction) User() string {
+	return i.dropIn.SystemPaths.User
+}
+
+func (i *baseDropInInstruction) String() string {
+	return fmt.Sprintf("%d:%s:%s", i.phase, i.explain, i.dropIn.Path)
+}
+
+// WriteDropInInstruction writes unit drop-in to filesystem and runs daemon reload.
+type WriteDropInInstruction struct {
+	*baseDropInInstruction
+}
+
+func NewWriteDropInInstruction(dropIn *allocation.DropIn) *WriteDropInInstruction {
+	return &WriteDropInInstruction{
+		&baseDropInInstruction{
+			phase:   phaseDeployFS,
+			explain: "write-dropin",
+			dropIn:  dropIn,
+		},
+	}
+}
+
+func (i *WriteDropInInstruction) Execute(conn *dbus.Conn) (err error) {
+	if err = i.dropIn.Write(); err != nil {
+		return
+	}
+	err = conn.Reload()
+	return
+}
+
+// DeleteDropInInstruction removes unit drop-in from filesystem and runs daemon reload.
+type DeleteDropInInstruction struct {
+	*baseDropInInstruction
+}
+
+func NewDeleteDropInInstruction(dropIn *allocation.DropIn) *DeleteDropInInstruction {
+	return &DeleteDropInInstruction{
+		&baseDropInInstruction{
+			phase:   phaseDestroyUnits,
+			explain: "delete-dropin",
+			dropIn:  dropIn,
+		},
+	}
+}
+
+func (i *DeleteDropInInstruction) Execute(conn *dbus.Conn) (err error) {
+	if err = i.dropIn.Remove(); err != nil {
+		return
+	}
+	err = conn.Reload()
+	return
+}
+
 type baseBlobInstruction struct {
 	phase   int
 	explain string
@@ -177,6 +256,10 @@ func NewWriteBlobInstruction(phase int, blob *allocation.Blob) (i *WriteBlobInst
 }
 
 func (i *WriteBlobInstruction) Execute(conn *dbus.Conn) (err error) {
+	if i.blob.IsArchive() {
+		err = i.blob.Extract()
+		return
+	}
 	err = i.baseBlobInstruction.blob.Write()
 	return
 }
@@ -197,6 +280,30 @@ func NewDestroyBlobInstruction(phase int, blob *allocation.Blob) (i *DestroyBlob
 }
 
 func (i *DestroyBlobInstruction) Execute(conn *dbus.Conn) (err error) {
-	err = os.Remove(i.blob.Name)
+	err = i.blob.Remove()
+	return
+}
+
+// DeleteBlobPathsInstruction removes paths which are no longer present in
+// archive
+type DeleteBlobPathsInstruction struct {
+	*baseBlobInstruction
+	paths []string
+}
+
+func NewDeleteBlobPathsInstruction(phase int, blob *allocation.Blob, paths []string) (i *DeleteBlobPathsInstruction) {
+	i = &DeleteBlobPathsInstruction{
+		baseBlobInstruction: &baseBlobInstruction{
+			phase:   phase,
+			explain: "delete-blob-paths",
+			blob:    blob,
+		},
+		paths: paths,
+	}
+	return
+}
+
+func (i *DeleteBlobPathsInstruction) Execute(conn *dbus.Conn) (err error) {
+	err = i.blob.RemovePaths(i.paths)
 	return
 }
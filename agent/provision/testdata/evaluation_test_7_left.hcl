@@ -0,0 +1,19 @@
+pod "pod-1" {
+  runtime = false
+  unit "unit-1.service" {
+    permanent = true
+    source = "fake"
+    dropin "10-env.conf" {
+      source = "[Service]\nEnvironment=A=1"
+    }
+  }
+  unit "docker.service" {
+    update = "restart"
+    dropin "10-env.conf" {
+      source = "[Service]\nEnvironment=A=1"
+    }
+    dropin "20-limits.conf" {
+      source = "[Service]\nLimitNOFILE=1024"
+    }
+  }
+}
@@ -0,0 +1,9 @@
+pod "pod-1" {
+  runtime = false
+  unit "backup.timer" {
+    source = "[Timer]\nOnCalendar=daily"
+  }
+  unit "backup.service" {
+    source = "[Service]\nType=oneshot"
+  }
+}
@@ -0,0 +1,13 @@
+pod "pod-1" {
+  mode = "transient"
+  unit "job.service" {
+    source = <<EOF
+      [Service]
+      Type=oneshot
+      ExecStart=/usr/bin/false
+    EOF
+  }
+  unit "job.timer" {
+    source = "[Timer]\nOnCalendar=hourly"
+  }
+}
@@ -0,0 +1,197 @@
+package provision
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/da-moon/soil/agent/allocation"
+	godbus "github.com/godbus/dbus/v5"
+)
+
+// execCommand is ExecStart-like property item with signature (sasb)
+type execCommand struct {
+	Path             string
+	Args             []string
+	UncleanIsFailure bool
+}
+
+// timerCalendar is TimersCalendar property item with signature (ss)
+type timerCalendar struct {
+	Base string
+	Spec string
+}
+
+var (
+	transientDependencies = map[string]struct{}{
+		"After": {}, "Before": {}, "Requires": {}, "Wants": {}, "BindsTo": {}, "Conflicts": {}, "PartOf": {},
+	}
+	transientStrings = map[string]struct{}{
+		"Description": {}, "Type": {}, "User": {}, "Group": {}, "WorkingDirectory": {}, "Restart": {}, "Slice": {},
+	}
+	transientBools = map[string]struct{}{
+		"RemainAfterExit": {}, "Persistent": {},
+	}
+	transientCommands = map[string]struct{}{
+		"ExecStart": {}, "ExecStartPre": {}, "ExecStartPost": {}, "ExecStop": {}, "ExecStopPost": {},
+	}
+)
+
+// TransientProperties returns properties for StartTransientUnit derived from
+// unit source. Comments and [Install] section are ignored. Pod unit also
+// carries own source in environment to recover pod after agent restart.
+func TransientProperties(unit *allocation.Unit) (res []dbus.Property, err error) {
+	var section string
+	var environment []string
+	commands := map[string][]execCommand{}
+	var calendars []timerCalendar
+	var order []string
+	for _, line := range strings.Split(unit.Source, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line
+			continue
+		}
+		if section == "[Install]" {
+			continue
+		}
+		chunks := strings.SplitN(line, "=", 2)
+		if len(chunks) != 2 {
+			err = fmt.Errorf(`%s: bad line %s`, unit.UnitName(), line)
+			return
+		}
+		key, value := strings.TrimSpace(chunks[0]), strings.TrimSpace(chunks[1])
+		if _, ok := transientDependencies[key]; ok {
+			res = append(res, dbus.Property{Name: key, Value: godbus.MakeVariant(strings.Fields(value))})
+			continue
+		}
+		if _, ok := transientStrings[key]; ok {
+			res = append(res, dbus.Property{Name: key, Value: godbus.MakeVariant(value)})
+			continue
+		}
+		if _, ok := transientBools[key]; ok {
+			var v bool
+			if v, err = parseBool(value); err != nil {
+				err = fmt.Errorf(`%s: %s: %v`, unit.UnitName(), key, err)
+				return
+			}
+			res = append(res, dbus.Property{Name: key, Value: godbus.MakeVariant(v)})
+			continue
+		}
+		if _, ok := transientCommands[key]; ok {
+			uncleanIsFailure := true
+			if strings.HasPrefix(value, "-") {
+				uncleanIsFailure = false
+				value = strings.TrimPrefix(value, "-")
+			}
+			args := splitQuoted(value)
+			if len(args) == 0 {
+				err = fmt.Errorf(`%s: empty %s`, unit.UnitName(), key)
+				return
+			}
+			if _, ok := commands[key]; !ok {
+				order = append(order, key)
+			}
+			commands[key] = append(commands[key], execCommand{
+				Path:             args[0],
+				Args:             args,
+				UncleanIsFailure: uncleanIsFailure,
+			})
+			continue
+		}
+		switch key {
+		case "Environment":
+			environment = append(environment, splitQuoted(value)...)
+		case "OnCalendar":
+			calendars = append(calendars, timerCalendar{Base: key, Spec: value})
+		default:
+			err = fmt.Errorf(`%s: %s is not supported in transient mode`, unit.UnitName(), key)
+			return
+		}
+	}
+	for _, key := range order {
+		res = append(res, dbus.Property{Name: key, Value: godbus.MakeVariant(commands[key])})
+	}
+	if len(calendars) > 0 {
+		res = append(res, dbus.Property{Name: "TimersCalendar", Value: godbus.MakeVariant(calendars)})
+	}
+	if unit.IsPodUnit() {
+		environment = append(environment, allocation.EncodeTransientSpec(unit.Source))
+	}
+	if len(environment) > 0 {
+		res = append(res, dbus.Property{Name: "Environment", Value: godbus.MakeVariant(environment)})
+	}
+	return
+}
+
+func parseBool(value string) (res bool, err error) {
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		res = true
+	case "no", "off":
+	default:
+		res, err = strconv.ParseBool(value)
+	}
+	return
+}
+
+// splitQuoted splits value by spaces respecting double and single quotes
+func splitQuoted(value string) (res []string) {
+	var current strings.Builder
+	var quote rune
+	var inToken bool
+	for _, r := range value {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+			inToken = true
+		case quote == 0 && (r == ' ' || r == '\t'):
+			if inToken {
+				res = append(res, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if inToken {
+		res = append(res, current.String())
+	}
+	return
+}
+
+// StartTransientInstruction creates and starts transient unit
+type StartTransientInstruction struct {
+	*baseUnitInstruction
+	unit *allocation.Unit
+}
+
+func NewStartTransientInstruction(phase int, unit *allocation.Unit) *StartTransientInstruction {
+	return &StartTransientInstruction{
+		baseUnitInstruction: newBaseInstruction(phase, "start-transient", unit.UnitFile),
+		unit:                unit,
+	}
+}
+
+func (i *StartTransientInstruction) Execute(conn *dbus.Conn) (err error) {
+	properties, err := TransientProperties(i.unit)
+	if err != nil {
+		return
+	}
+	// failed transient units are kept by systemd until reset
+	conn.ResetFailedUnit(i.unit.UnitName())
+	ch := make(chan string)
+	if _, err = conn.StartTransientUnit(i.unit.UnitName(), "replace", properties, ch); err != nil {
+		return
+	}
+	<-ch
+	return
+}
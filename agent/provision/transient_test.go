@@ -0,0 +1,113 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package provision_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/provision"
+	"github.com/da-moon/soil/manifest"
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransientProperties(t *testing.T) {
+	t.Run(`0 service`, func(t *testing.T) {
+		unit := &allocation.Unit{
+			UnitFile: allocation.UnitFile{
+				Path: "/run/systemd/transient/job.service",
+				Source: `
+# comment
+[Unit]
+Description=My job
+After=network.target time-sync.target
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+Environment="A=1 2" B=3
+ExecStart=-/usr/bin/echo "hello world"
+[Install]
+WantedBy=multi-user.target
+`,
+			},
+			Transient: true,
+		}
+		res, err := provision.TransientProperties(unit)
+		assert.NoError(t, err)
+		assert.Len(t, res, 6)
+		assert.Equal(t, dbus.Property{Name: "Description", Value: godbus.MakeVariant("My job")}, res[0])
+		assert.Equal(t, dbus.Property{Name: "After", Value: godbus.MakeVariant([]string{"network.target", "time-sync.target"})}, res[1])
+		assert.Equal(t, dbus.Property{Name: "RemainAfterExit", Value: godbus.MakeVariant(true)}, res[3])
+		assert.Equal(t, "ExecStart", res[4].Name)
+		assert.Equal(t, "a(sasb)", res[4].Value.Signature().String())
+		assert.Contains(t, fmt.Sprintf("%v", res[4].Value.Value()), "[/usr/bin/echo hello world] false")
+		assert.Equal(t, dbus.Property{Name: "Environment", Value: godbus.MakeVariant([]string{"A=1 2", "B=3"})}, res[5])
+	})
+	t.Run(`1 unsupported`, func(t *testing.T) {
+		_, err := provision.TransientProperties(&allocation.Unit{
+			UnitFile: allocation.UnitFile{
+				Path:   "/run/systemd/transient/job.service",
+				Source: "[Service]\nLimitNOFILE=1024",
+			},
+		})
+		assert.EqualError(t, err, "job.service: LimitNOFILE is not supported in transient mode")
+	})
+	t.Run(`2 pod unit`, func(t *testing.T) {
+		pod := &allocation.Pod{}
+		pod.Mode = allocation.ModeTransient
+		pod.UnitFile = allocation.NewTransientUnitFile("pod-private-1.service", allocation.DefaultSystemPaths())
+		pod.Source = "### POD {}\n[Unit]\nDescription=1\n[Service]\nExecStart=/usr/bin/sleep inf\n"
+		res, err := provision.TransientProperties(pod.GetPodUnit())
+		assert.NoError(t, err)
+		env := res[len(res)-1]
+		assert.Equal(t, "Environment", env.Name)
+		source, ok := allocation.DecodeTransientSpec(env.Value.Value().([]string)[0])
+		assert.True(t, ok)
+		assert.Equal(t, pod.Source, source)
+	})
+	t.Run(`3 secrets`, func(t *testing.T) {
+		key, err := manifest.GenerateSecretKey()
+		assert.NoError(t, err)
+		value, err := key.Encrypt("hunter2")
+		assert.NoError(t, err)
+		m := &manifest.Pod{
+			Namespace: "private",
+			Name:      "db",
+			Mode:      allocation.ModeTransient,
+			Target:    "multi-user.target",
+			Secrets:   manifest.Secrets{{Name: "password", Value: value}},
+			Blobs:     manifest.Blobs{{Name: "/etc/db/password", Source: "${secret.password}"}},
+			Units: manifest.Units{
+				{Name: "db.service", Source: "[Service]\nExecStart=/usr/bin/db --password-file /etc/db/password\n"},
+			},
+		}
+		pod := &allocation.Pod{SecretKey: key}
+		assert.NoError(t, pod.FromManifest(m, map[string]string{
+			"system.pod_exec": "ExecStart=/usr/bin/sleep inf",
+		}))
+		assert.Equal(t, "hunter2", pod.Blobs[0].Source)
+		for _, unit := range append(allocation.UnitSlice{pod.GetPodUnit()}, pod.Units...) {
+			res, err := provision.TransientProperties(unit)
+			assert.NoError(t, err)
+			for _, property := range res {
+				assert.NotContains(t, fmt.Sprintf("%v", property.Value.Value()), "hunter2")
+				if property.Name != "Environment" {
+					continue
+				}
+				for _, item := range property.Value.Value().([]string) {
+					if source, ok := allocation.DecodeTransientSpec(item); ok {
+						assert.NotContains(t, source, "hunter2")
+					}
+				}
+			}
+		}
+
+		m.Units[0].Source = "[Service]\nExecStart=/usr/bin/db --password ${secret.password}\n"
+		assert.EqualError(t, (&allocation.Pod{SecretKey: key}).FromManifest(m, map[string]string{}),
+			"pod db: secrets are not supported in transient unit db.service")
+	})
+}
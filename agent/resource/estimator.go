@@ -34,12 +34,33 @@ type Estimator interface {
 	io.Closer
 }
 
+// Bounded estimator can allocate finite number of values
+type Bounded interface {
+
+	// Total number of values which can be allocated
+	Total() (total uint64)
+}
+
 func GetEstimator(globalConfig estimator.GlobalConfig, config estimator.Config) (e Estimator, err error) {
 	switch config.Provider.Kind {
 	case "blackhole":
 		e = estimator.NewBlackhole(globalConfig, config)
 	case "range":
 		e = estimator.NewRange(globalConfig, config)
+	case estimator.PoolEstimator:
+		e = estimator.NewPool(globalConfig, config)
+	case estimator.PortEstimator:
+		e = estimator.NewPort(globalConfig, config)
+	case estimator.CapacityEstimator:
+		e = estimator.NewCapacity(globalConfig, config)
+	case estimator.IpamEstimator:
+		e = estimator.NewIpam(globalConfig, config)
+	case estimator.UidEstimator:
+		e = estimator.NewUid(globalConfig, config)
+	case estimator.VolumeEstimator:
+		e = estimator.NewVolume(globalConfig, config)
+	case estimator.ExecEstimator:
+		e = estimator.NewExec(globalConfig, config)
 	default:
 		e = estimator.NewInvalid(globalConfig, config)
 	}
@@ -0,0 +1,322 @@
+package estimator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/da-moon/soil/manifest"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	CapacityEstimator = "capacity" // capacity estimator name
+
+	CapacityCPU    = "cpu"    // CPU in millicores
+	CapacityMemory = "memory" // Memory in bytes
+
+	capacityMeminfoPath = "/proc/meminfo"
+)
+
+var capacityUnits = map[string]uint64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+type capacityAllocation struct {
+	request map[string]uint64
+	pending map[string]uint64 // updated request which doesn't fit yet
+	failure error
+}
+
+// Capacity allocates amounts of named dimensions like "cpu" and "memory"
+// from totals configured by provider. Allocation fails if sum of allocated
+// amounts exceeds total in any dimension.
+type Capacity struct {
+	*base
+	configErr error
+
+	total       map[string]uint64
+	used        map[string]uint64
+	allocations map[string]capacityAllocation // allocations by id
+}
+
+func NewCapacity(globalConfig GlobalConfig, config Config) (c *Capacity) {
+	c = &Capacity{
+		total:       hostCapacity(),
+		used:        map[string]uint64{},
+		allocations: map[string]capacityAllocation{},
+	}
+	c.configErr = c.configure(config.Provider.Config)
+	if scopeErr := config.nodeScopeOnly(); scopeErr != nil {
+		c.configErr = multierror.Append(c.configErr, scopeErr).ErrorOrNil()
+	}
+	c.base = newBase(globalConfig, config, c)
+	if c.configErr != nil {
+		c.log.Errorf(`bad config: %v`, c.configErr)
+	}
+	return
+}
+
+func (c *Capacity) configure(config map[string]interface{}) (err error) {
+	err = &multierror.Error{}
+	for dimension, raw := range config {
+		if dimension == "scope" {
+			continue
+		}
+		value, parseErr := parseCapacity(raw)
+		if parseErr != nil {
+			err = multierror.Append(err, fmt.Errorf(`%s: %v`, dimension, parseErr))
+			continue
+		}
+		c.total[dimension] = value
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+func (c *Capacity) createFn(id string, config map[string]interface{}, values map[string]string) (res interface{}, err error) {
+	if allocated, ok := c.allocations[id]; ok && allocated.failure == nil {
+		c.log.Tracef(`"%s" is already allocated: %v`, id, allocated.request)
+		return
+	}
+	res, err = c.try(id, config)
+	return
+}
+
+func (c *Capacity) updateFn(id string, config map[string]interface{}) (res interface{}, err error) {
+	state, ok := c.allocations[id]
+	if !ok {
+		err = fmt.Errorf(`not found: %s`, id)
+		return
+	}
+	if state.failure == nil {
+		if request, parseErr := c.parseRequest(config); parseErr == nil {
+			if isEqualCapacity(request, state.request) {
+				state.pending = nil
+				c.allocations[id] = state
+				err = fmt.Errorf(`already allocated: %s`, id)
+				return
+			}
+			// keep old allocation until new amounts fit
+			if !c.fits(request, state.request) {
+				c.log.Warningf(`update of %s is pending: %v`, id, ErrNotAvailable)
+				state.pending = request
+				c.allocations[id] = state
+				return
+			}
+		}
+	}
+	c.release(id)
+	res, err = c.try(id, config)
+	return
+}
+
+func (c *Capacity) destroyFn(id string) (err error) {
+	state, ok := c.allocations[id]
+	if !ok {
+		err = fmt.Errorf(`not found: %s`, id)
+		return
+	}
+	c.release(id)
+	delete(c.allocations, id)
+	c.log.Tracef(`deallocated: %s: %v`, id, state)
+	c.send(id, nil, nil)
+
+	for allocatedId, alloc := range c.allocations {
+		switch {
+		case alloc.failure != nil && alloc.request != nil:
+			if reallocErr := c.allocate(allocatedId, alloc.request); reallocErr != nil {
+				c.log.Warningf(`fail to reallocate "%s": %v`, allocatedId, reallocErr)
+				continue
+			}
+			c.log.Infof(`reallocated %s: %v`, allocatedId, alloc.request)
+		case alloc.failure == nil && alloc.pending != nil:
+			if !c.fits(alloc.pending, alloc.request) {
+				continue
+			}
+			c.release(allocatedId)
+			if reallocErr := c.allocate(allocatedId, alloc.pending); reallocErr != nil {
+				c.log.Warningf(`fail to update "%s": %v`, allocatedId, reallocErr)
+				continue
+			}
+			c.log.Infof(`updated %s: %v`, allocatedId, alloc.pending)
+		}
+	}
+	return
+}
+
+func (c *Capacity) shutdownFn() (err error) {
+	return
+}
+
+func (c *Capacity) try(id string, config map[string]interface{}) (res map[string]uint64, err error) {
+	if c.configErr != nil {
+		err = c.configErr
+		c.notify(id, capacityAllocation{
+			failure: err,
+		})
+		return
+	}
+	if res, err = c.parseRequest(config); err != nil {
+		c.notify(id, capacityAllocation{
+			failure: err,
+		})
+		return
+	}
+	err = c.allocate(id, res)
+	return
+}
+
+// allocate allocates request or notifies about failure
+func (c *Capacity) allocate(id string, request map[string]uint64) (err error) {
+	if !c.fits(request, nil) {
+		err = ErrNotAvailable
+		c.notify(id, capacityAllocation{
+			request: request,
+			failure: err,
+		})
+		return
+	}
+	for dimension, amount := range request {
+		c.used[dimension] += amount
+	}
+	c.notify(id, capacityAllocation{
+		request: request,
+	})
+	return
+}
+
+// fits returns true if request fits totals when replaced amounts are freed
+func (c *Capacity) fits(request, replaced map[string]uint64) (ok bool) {
+	for dimension, amount := range request {
+		if c.used[dimension]-replaced[dimension]+amount > c.total[dimension] {
+			return
+		}
+	}
+	ok = true
+	return
+}
+
+// release frees amounts allocated by id
+func (c *Capacity) release(id string) {
+	state := c.allocations[id]
+	if state.failure != nil {
+		return
+	}
+	for dimension, amount := range state.request {
+		c.used[dimension] -= amount
+	}
+}
+
+func (c *Capacity) parseRequest(config map[string]interface{}) (res map[string]uint64, err error) {
+	res = map[string]uint64{}
+	var dimensions []string
+	for dimension := range config {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Strings(dimensions)
+	for _, dimension := range dimensions {
+		if _, ok := c.total[dimension]; !ok {
+			err = fmt.Errorf(`unknown dimension: %s`, dimension)
+			return
+		}
+		if res[dimension], err = parseCapacity(config[dimension]); err != nil {
+			err = fmt.Errorf(`%s: %v`, dimension, err)
+			return
+		}
+	}
+	return
+}
+
+func (c *Capacity) notify(id string, alloc capacityAllocation) {
+	c.allocations[id] = alloc
+	var values manifest.FlatMap
+	if alloc.failure == nil {
+		values = manifest.FlatMap{}
+		for dimension, amount := range alloc.request {
+			values[dimension] = strconv.FormatUint(amount, 10)
+		}
+		if cpu, ok := alloc.request[CapacityCPU]; ok {
+			values["cpu_quota"] = fmt.Sprintf("%d%%", cpu/10)
+		}
+	}
+	c.send(id, alloc.failure, values)
+	c.log.Debugf(`downstream notified: %s:%v`, id, alloc)
+}
+
+func isEqualCapacity(left, right map[string]uint64) (ok bool) {
+	if len(left) != len(right) {
+		return
+	}
+	for k, v := range left {
+		if right[k] != v {
+			return
+		}
+	}
+	ok = true
+	return
+}
+
+// parseCapacity parses number with optional "K", "M", "G" or "T" suffix
+func parseCapacity(raw interface{}) (res uint64, err error) {
+	switch v := raw.(type) {
+	case int:
+		if v < 0 {
+			err = fmt.Errorf(`negative value: %d`, v)
+		}
+		res = uint64(v)
+	case float64:
+		if v < 0 || v != float64(uint64(v)) {
+			err = fmt.Errorf(`bad value: %v`, v)
+		}
+		res = uint64(v)
+	case string:
+		v = strings.ToUpper(strings.TrimSpace(v))
+		unit := strings.TrimLeft(v, "0123456789")
+		multiplier, ok := capacityUnits[unit]
+		if !ok {
+			err = fmt.Errorf(`bad value: %s`, raw)
+			return
+		}
+		if res, err = strconv.ParseUint(strings.TrimSuffix(v, unit), 10, 64); err != nil {
+			err = fmt.Errorf(`bad value: %s`, raw)
+			return
+		}
+		res *= multiplier
+	default:
+		err = fmt.Errorf(`bad value: %v`, raw)
+	}
+	return
+}
+
+// hostCapacity returns CPU and memory of host
+func hostCapacity() (res map[string]uint64) {
+	res = map[string]uint64{
+		CapacityCPU: uint64(runtime.NumCPU()) * 1000,
+	}
+	f, err := os.Open(capacityMeminfoPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		if kb, parseErr := strconv.ParseUint(fields[1], 10, 64); parseErr == nil {
+			res[CapacityMemory] = kb << 10
+		}
+		break
+	}
+	return
+}
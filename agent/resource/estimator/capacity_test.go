@@ -0,0 +1,130 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package estimator_test
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/agent/resource/estimator"
+	"github.com/da-moon/soil/fixture"
+	"github.com/da-moon/soil/manifest"
+	"testing"
+)
+
+func TestCapacity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := estimator.NewCapacity(estimator.GlobalConfig{}, estimator.Config{
+		Ctx: ctx,
+		Log: logx.GetLog("test"),
+		Provider: &allocation.Provider{
+			Kind: "capacity",
+			Name: "host",
+			Config: map[string]interface{}{
+				"cpu":    4000,
+				"memory": "1G",
+				"disk":   float64(100),
+			},
+		},
+	})
+	defer c.Close()
+	cons := consumeResults(ctx, c)
+	request := func(name string, config map[string]interface{}) *allocation.Resource {
+		return &allocation.Resource{
+			Request: manifest.Resource{Provider: "host", Name: name, Config: config},
+		}
+	}
+
+	t.Run("allocate", func(t *testing.T) {
+		c.Create("a", request("a", map[string]interface{}{"cpu": 1000, "memory": "512M", "disk": 10}))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.cpu":       "1000",
+				"a.cpu_quota": "100%",
+				"a.memory":    "536870912",
+				"a.disk":      "10",
+			}),
+		))
+	})
+	t.Run("not available", func(t *testing.T) {
+		c.Create("b", request("b", map[string]interface{}{"cpu": 3000, "memory": "600M"}))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.cpu":       "1000",
+				"a.cpu_quota": "100%",
+				"a.memory":    "536870912",
+				"a.disk":      "10",
+				"b.allocated": "false",
+				"b.failure":   "not-available",
+			}),
+		))
+	})
+	t.Run("unknown dimension", func(t *testing.T) {
+		c.Create("c", request("c", map[string]interface{}{"gpu": 1}))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.cpu":       "1000",
+				"a.cpu_quota": "100%",
+				"a.memory":    "536870912",
+				"a.disk":      "10",
+				"b.allocated": "false",
+				"b.failure":   "not-available",
+				"c.allocated": "false",
+				"c.failure":   "unknown dimension: gpu",
+			}),
+		))
+	})
+	t.Run("destroy reallocates", func(t *testing.T) {
+		c.Destroy("a")
+		c.Destroy("c")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"b.allocated": "true",
+				"b.cpu":       "3000",
+				"b.cpu_quota": "300%",
+				"b.memory":    "629145600",
+			}),
+		))
+	})
+	t.Run("update", func(t *testing.T) {
+		c.Update("b", request("b", map[string]interface{}{"cpu": 4000}))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"b.allocated": "true",
+				"b.cpu":       "4000",
+				"b.cpu_quota": "400%",
+			}),
+		))
+	})
+	t.Run("update keeps allocation", func(t *testing.T) {
+		c.Update("b", request("b", map[string]interface{}{"cpu": 2000, "memory": "2G"}))
+		c.Create("d", request("d", map[string]interface{}{"disk": 10}))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"b.allocated": "true",
+				"b.cpu":       "4000",
+				"b.cpu_quota": "400%",
+				"d.allocated": "true",
+				"d.disk":      "10",
+			}),
+		))
+	})
+	t.Run("pending update applied on destroy", func(t *testing.T) {
+		c.Update("d", request("d", map[string]interface{}{"cpu": 1000}))
+		c.Destroy("b")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"d.allocated": "true",
+				"d.cpu":       "1000",
+				"d.cpu_quota": "100%",
+			}),
+		))
+	})
+}
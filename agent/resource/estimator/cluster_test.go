@@ -0,0 +1,224 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package estimator_test
+
+import (
+	"context"
+	"errors"
+	"github.com/akaspin/logx"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/agent/resource/estimator"
+	"github.com/da-moon/soil/fixture"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+type testingClaimer struct {
+	mu       sync.Mutex
+	notReady bool
+	foreign  map[string]string // keys claimed by this node in previous run or by other nodes
+	claims   map[string]string
+}
+
+func (c *testingClaimer) Claim(key string, value []byte) (ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.notReady {
+		err = errors.New("backend is not ready")
+		return
+	}
+	if owner, foreign := c.foreign[key]; foreign && owner != string(value) {
+		return
+	}
+	c.claims[key] = string(value)
+	ok = true
+	return
+}
+
+func (c *testingClaimer) Release(key string) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.claims, key)
+	return
+}
+
+func (c *testingClaimer) setReady() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notReady = false
+}
+
+func (c *testingClaimer) get() (res map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res = map[string]string{}
+	for k, v := range c.claims {
+		res[k] = v
+	}
+	return
+}
+
+func TestRange_ClusterScope(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claimer := &testingClaimer{
+		foreign: map[string]string{
+			"resource/claims/port/8000": "other",
+		},
+		claims: map[string]string{},
+	}
+	r := estimator.NewRange(estimator.GlobalConfig{Claimer: claimer}, estimator.Config{
+		Ctx: ctx,
+		Log: logx.GetLog("test"),
+		Id:  "port",
+		Provider: &allocation.Provider{
+			Kind: "range",
+			Name: "port",
+			Config: map[string]interface{}{
+				"min":   8000,
+				"max":   8001,
+				"scope": "cluster",
+			},
+		},
+	})
+	defer r.Close()
+	cons := consumeResults(ctx, r)
+
+	t.Run("skip foreign", func(t *testing.T) {
+		r.Create("a", &allocation.Resource{
+			Request: manifest.Resource{Provider: "port", Name: "a"},
+			Values:  manifest.FlatMap{"value": "8000"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "8001",
+			}),
+		))
+		assert.Equal(t, map[string]string{"resource/claims/port/8001": "a"}, claimer.get())
+	})
+	t.Run("not available", func(t *testing.T) {
+		r.Create("b", &allocation.Resource{
+			Request: manifest.Resource{Provider: "port", Name: "b"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "8001",
+				"b.allocated": "false",
+				"b.failure":   "not-available",
+			}),
+		))
+	})
+	t.Run("destroy releases claim", func(t *testing.T) {
+		r.Destroy("a")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"b.allocated": "true",
+				"b.value":     "8001",
+			}),
+		))
+		assert.Equal(t, map[string]string{"resource/claims/port/8001": "b"}, claimer.get())
+	})
+}
+
+func TestRange_ClusterScopeRecovered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claimer := &testingClaimer{
+		notReady: true,
+		foreign: map[string]string{
+			"resource/claims/port/8000": "other",
+			"resource/claims/port/8001": "a",
+		},
+		claims: map[string]string{},
+	}
+	config := newTestConfig(ctx, "range", "port", map[string]interface{}{
+		"min":   8000,
+		"max":   8002,
+		"scope": "cluster",
+	})
+	config.Id = "port"
+	r := estimator.NewRange(estimator.GlobalConfig{Claimer: claimer}, config)
+	defer r.Close()
+	cons := consumeResults(ctx, r)
+
+	t.Run("backend is not ready", func(t *testing.T) {
+		r.Create("a", &allocation.Resource{
+			Request: manifest.Resource{Provider: "port", Name: "a"},
+			Values:  manifest.FlatMap{"value": "8001"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "false",
+				"a.failure":   "backend is not ready",
+			}),
+		))
+	})
+	t.Run("recovered value is kept", func(t *testing.T) {
+		claimer.setReady()
+		r.Create("b", &allocation.Resource{
+			Request: manifest.Resource{Provider: "port", Name: "b"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "false",
+				"a.failure":   "backend is not ready",
+				"b.allocated": "true",
+				"b.value":     "8002",
+			}),
+		))
+	})
+	t.Run("retry claims owned value", func(t *testing.T) {
+		r.Update("a", &allocation.Resource{})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "8001",
+				"b.allocated": "true",
+				"b.value":     "8002",
+			}),
+		))
+		assert.Equal(t, map[string]string{
+			"resource/claims/port/8001": "a",
+			"resource/claims/port/8002": "b",
+		}, claimer.get())
+	})
+}
+
+func TestRange_ClusterScopeWithoutClaimer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := estimator.NewRange(estimator.GlobalConfig{}, estimator.Config{
+		Ctx: ctx,
+		Log: logx.GetLog("test"),
+		Id:  "port",
+		Provider: &allocation.Provider{
+			Kind: "range",
+			Name: "port",
+			Config: map[string]interface{}{
+				"min":   8000,
+				"max":   8001,
+				"scope": "cluster",
+			},
+		},
+	})
+	defer r.Close()
+	cons := consumeResults(ctx, r)
+	r.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "port", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "false",
+			"a.failure":   "cluster scope is not available",
+		}),
+	))
+}
@@ -2,12 +2,31 @@ package estimator
 
 import (
 	"context"
+	"fmt"
 	"github.com/akaspin/logx"
 	"github.com/da-moon/soil/agent/allocation"
 )
 
+const (
+	ScopeNode    = "node"    // Values are unique within node
+	ScopeCluster = "cluster" // Values are unique within cluster
+)
+
+// Claimer claims keys across cluster
+type Claimer interface {
+	Claim(key string, value []byte) (ok bool, err error)
+	Release(key string) (err error)
+}
+
+// PodChecker checks state of deployed pods
+type PodChecker interface {
+	IsActive(name string) (ok bool)
+}
+
 // Global estimator config
 type GlobalConfig struct {
+	Claimer Claimer    // Claimer for cluster scoped providers
+	Pods    PodChecker // Deployed pods
 }
 
 // Config
@@ -17,3 +36,27 @@ type Config struct {
 	Provider *allocation.Provider
 	Id       string // Full provider ID
 }
+
+// scope returns provider scope
+func (c Config) scope() (res string, err error) {
+	res = ScopeNode
+	raw, ok := c.Provider.Config["scope"]
+	if !ok {
+		return
+	}
+	switch res = fmt.Sprint(raw); res {
+	case ScopeNode, ScopeCluster:
+	default:
+		err = fmt.Errorf(`bad scope: %s`, res)
+	}
+	return
+}
+
+// nodeScopeOnly returns error if provider is not node scoped
+func (c Config) nodeScopeOnly() (err error) {
+	scope, err := c.scope()
+	if err == nil && scope != ScopeNode {
+		err = fmt.Errorf(`%s scope is not supported by %s`, scope, c.Provider.Kind)
+	}
+	return
+}
@@ -0,0 +1,41 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package estimator_test
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/agent/bus/pipe"
+	"github.com/da-moon/soil/agent/resource/estimator"
+)
+
+// newTestConfig returns estimator config for provider with given kind, name and config
+func newTestConfig(ctx context.Context, kind, name string, config map[string]interface{}) estimator.Config {
+	return estimator.Config{
+		Ctx: ctx,
+		Log: logx.GetLog("test"),
+		Provider: &allocation.Provider{
+			Kind:   kind,
+			Name:   name,
+			Config: config,
+		},
+	}
+}
+
+// consumeResults pipes estimator results to new testing consumer
+func consumeResults(ctx context.Context, e interface {
+	Results() (uid string, ctx context.Context, ch chan *estimator.Result)
+}) (cons *bus.TestingConsumer) {
+	cons = bus.NewTestingConsumer(ctx)
+	downstream := pipe.NewLift("test", cons)
+	_, _, ch := e.Results()
+	go func() {
+		for res := range ch {
+			downstream.ConsumeMessage(res.Message)
+		}
+	}()
+	return
+}
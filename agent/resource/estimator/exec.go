@@ -0,0 +1,404 @@
+package estimator
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/da-moon/soil/manifest"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	ExecEstimator = "exec" // exec estimator name
+
+	ExecOpInit     = "init"
+	ExecOpCreate   = "create"
+	ExecOpUpdate   = "update"
+	ExecOpDestroy  = "destroy"
+	ExecOpShutdown = "shutdown"
+
+	defaultExecTimeout = time.Second * 10
+	defaultExecRestart = time.Second * 5
+	execQueueSize      = 128
+)
+
+var (
+	errExecTimeout    = errors.New("plugin timeout")
+	errExecBusy       = errors.New("plugin is busy")
+	errExecNotRunning = errors.New("plugin is not running")
+)
+
+// ExecRequest is sent to plugin stdin as single JSON line
+type ExecRequest struct {
+	Op     string                 `json:"op"`
+	Id     string                 `json:"id,omitempty"`
+	Config map[string]interface{} `json:"config,omitempty"`
+	Values manifest.FlatMap       `json:"values,omitempty"`
+}
+
+// ExecResponse is read from plugin stdout as single JSON line
+type ExecResponse struct {
+	Id      string           `json:"id"`
+	Values  manifest.FlatMap `json:"values,omitempty"`
+	Failure string           `json:"failure,omitempty"`
+}
+
+type execResource struct {
+	config    map[string]interface{}
+	recovered manifest.FlatMap // values to recover on plugin (re)start
+	timer     *time.Timer      // pending create or update
+}
+
+type execProcess struct {
+	cmd      *exec.Cmd
+	requests chan *ExecRequest
+	done     chan struct{}
+	err      error
+}
+
+// Exec delegates allocations to external plugin. Plugin reads requests
+// from stdin and writes results to stdout line by line. Plugin is
+// restarted on exit and all known resources are recreated with last
+// allocated values.
+type Exec struct {
+	*base
+	configErr error
+
+	command string
+	args    []string
+	env     []string
+	timeout time.Duration
+	restart time.Duration
+
+	mu           sync.Mutex
+	proc         *execProcess
+	resources    map[string]*execResource // resources by id
+	shuttingDown bool
+}
+
+func NewExec(globalConfig GlobalConfig, config Config) (e *Exec) {
+	e = &Exec{
+		timeout:   defaultExecTimeout,
+		restart:   defaultExecRestart,
+		resources: map[string]*execResource{},
+	}
+	e.configErr = e.configure(config.Provider.Config)
+	if scopeErr := config.nodeScopeOnly(); scopeErr != nil {
+		e.configErr = multierror.Append(e.configErr, scopeErr).ErrorOrNil()
+	}
+	e.base = newBase(globalConfig, config, e)
+	if e.configErr != nil {
+		e.log.Errorf(`bad config: %v`, e.configErr)
+		return
+	}
+	go e.supervise()
+	return
+}
+
+func (e *Exec) configure(config map[string]interface{}) (err error) {
+	err = &multierror.Error{}
+	if e.command = fmt.Sprint(config["command"]); config["command"] == nil || e.command == "" {
+		err = multierror.Append(err, fmt.Errorf(`command is not defined`))
+	}
+	e.args = toStrings(config["args"])
+	e.env = toStrings(config["env"])
+	for key, value := range map[string]*time.Duration{"timeout": &e.timeout, "restart": &e.restart} {
+		raw, ok := config[key]
+		if !ok {
+			continue
+		}
+		var parseErr error
+		if *value, parseErr = time.ParseDuration(fmt.Sprint(raw)); parseErr != nil {
+			err = multierror.Append(err, fmt.Errorf(`bad %s: %v`, key, raw))
+		}
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+func (e *Exec) createFn(id string, config map[string]interface{}, values map[string]string) (res interface{}, err error) {
+	if e.configErr != nil {
+		e.send(id, e.configErr, nil)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.resources[id]; ok {
+		err = fmt.Errorf(`already exists: %s`, id)
+		return
+	}
+	resource := &execResource{
+		config:    config,
+		recovered: values,
+	}
+	e.resources[id] = resource
+	if e.proc == nil {
+		// resource will be created on plugin start
+		return
+	}
+	e.request(id, resource, &ExecRequest{
+		Op:     ExecOpCreate,
+		Id:     id,
+		Config: config,
+		Values: values,
+	})
+	return
+}
+
+func (e *Exec) updateFn(id string, config map[string]interface{}) (res interface{}, err error) {
+	if e.configErr != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resource, ok := e.resources[id]
+	if !ok {
+		err = fmt.Errorf(`not found: %s`, id)
+		return
+	}
+	resource.config = config
+	if e.proc == nil {
+		return
+	}
+	e.request(id, resource, &ExecRequest{
+		Op:     ExecOpUpdate,
+		Id:     id,
+		Config: config,
+	})
+	return
+}
+
+func (e *Exec) destroyFn(id string) (err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if resource, ok := e.resources[id]; ok {
+		resource.stop()
+		delete(e.resources, id)
+		if e.proc != nil {
+			if enqueueErr := e.proc.enqueue(&ExecRequest{
+				Op: ExecOpDestroy,
+				Id: id,
+			}); enqueueErr != nil {
+				e.log.Warningf(`can't send destroy %s to plugin: %v`, id, enqueueErr)
+			}
+		}
+	}
+	e.send(id, nil, nil)
+	return
+}
+
+func (e *Exec) shutdownFn() (err error) {
+	e.mu.Lock()
+	proc := e.proc
+	e.shuttingDown = true
+	for _, resource := range e.resources {
+		resource.stop()
+	}
+	e.mu.Unlock()
+	if proc == nil {
+		return
+	}
+	if err = proc.enqueue(&ExecRequest{Op: ExecOpShutdown}); err != nil {
+		return
+	}
+	select {
+	case <-proc.done:
+	case <-time.After(e.timeout):
+		err = errExecTimeout
+	}
+	return
+}
+
+// request sends request to plugin and arms timeout. Plugin which is not
+// responded in time is killed to be restarted. Should be called under lock.
+func (e *Exec) request(id string, resource *execResource, req *ExecRequest) {
+	proc := e.proc
+	if err := proc.enqueue(req); err != nil {
+		e.send(id, err, nil)
+		return
+	}
+	resource.stop()
+	var timer *time.Timer
+	timer = time.AfterFunc(e.timeout, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if current, ok := e.resources[id]; ok && current.timer == timer {
+			current.timer = nil
+			e.log.Warningf(`plugin is not responded in %v: %s`, e.timeout, id)
+			e.send(id, errExecTimeout, nil)
+			if e.proc == proc {
+				proc.cmd.Process.Kill()
+			}
+		}
+	})
+	resource.timer = timer
+}
+
+// handle handles plugin response
+func (e *Exec) handle(resp *ExecResponse) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resource, ok := e.resources[resp.Id]
+	if !ok {
+		e.log.Warningf(`ignore response for unknown resource: %v`, resp)
+		return
+	}
+	resource.stop()
+	if resp.Failure != "" {
+		e.send(resp.Id, errors.New(resp.Failure), nil)
+		return
+	}
+	values := manifest.FlatMap{}
+	for k, v := range resp.Values {
+		values[k] = v
+	}
+	resource.recovered = values
+	e.send(resp.Id, nil, values)
+}
+
+// supervise starts plugin and restarts it on exit
+func (e *Exec) supervise() {
+	for {
+		proc, err := e.start()
+		if err == nil {
+			<-proc.done
+			err = proc.err
+		}
+		e.mu.Lock()
+		e.proc = nil
+		if e.shuttingDown || e.ctx.Err() != nil {
+			e.mu.Unlock()
+			return
+		}
+		e.log.Errorf(`plugin exited: %v`, err)
+		failure := fmt.Errorf(`plugin exited: %v`, err)
+		for id, resource := range e.resources {
+			resource.stop()
+			e.send(id, failure, nil)
+		}
+		e.mu.Unlock()
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-time.After(e.restart):
+		}
+	}
+}
+
+// start starts plugin and recreates all known resources
+func (e *Exec) start() (proc *execProcess, err error) {
+	cmd := exec.CommandContext(e.ctx, e.command, e.args...)
+	cmd.Env = append(os.Environ(), e.env...)
+	var stdin io.WriteCloser
+	var stdout, stderr io.ReadCloser
+	if stdin, err = cmd.StdinPipe(); err != nil {
+		return
+	}
+	if stdout, err = cmd.StdoutPipe(); err != nil {
+		return
+	}
+	if stderr, err = cmd.StderrPipe(); err != nil {
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		return
+	}
+	e.log.Infof(`plugin started: %s %v (pid %d)`, e.command, e.args, cmd.Process.Pid)
+	proc = &execProcess{
+		cmd:      cmd,
+		requests: make(chan *ExecRequest, execQueueSize),
+		done:     make(chan struct{}),
+	}
+	go proc.write(stdin, e)
+	readers := &sync.WaitGroup{}
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			e.log.Infof(`plugin: %s`, scanner.Text())
+		}
+	}()
+	go func() {
+		defer readers.Done()
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			var resp ExecResponse
+			if decodeErr := json.Unmarshal(scanner.Bytes(), &resp); decodeErr != nil {
+				e.log.Warningf(`can't decode plugin response %s: %v`, scanner.Text(), decodeErr)
+				continue
+			}
+			e.handle(&resp)
+		}
+	}()
+	go func() {
+		readers.Wait()
+		proc.err = cmd.Wait()
+		close(proc.done)
+	}()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.proc = proc
+	if enqueueErr := proc.enqueue(&ExecRequest{
+		Op:     ExecOpInit,
+		Id:     e.config.Id,
+		Config: e.config.Provider.Config,
+	}); enqueueErr != nil {
+		e.log.Errorf(`can't init plugin: %v`, enqueueErr)
+	}
+	for id, resource := range e.resources {
+		e.request(id, resource, &ExecRequest{
+			Op:     ExecOpCreate,
+			Id:     id,
+			Config: resource.config,
+			Values: resource.recovered,
+		})
+	}
+	return
+}
+
+// enqueue puts request to plugin queue without blocking
+func (p *execProcess) enqueue(req *ExecRequest) (err error) {
+	select {
+	case <-p.done:
+		err = errExecNotRunning
+	case p.requests <- req:
+	default:
+		err = errExecBusy
+	}
+	return
+}
+
+// write writes queued requests to plugin stdin
+func (p *execProcess) write(stdin io.WriteCloser, e *Exec) {
+	defer stdin.Close()
+	encoder := json.NewEncoder(stdin)
+	for {
+		select {
+		case <-p.done:
+			return
+		case req := <-p.requests:
+			if err := encoder.Encode(req); err != nil {
+				e.log.Errorf(`can't write to plugin: %v`, err)
+				p.cmd.Process.Kill()
+				return
+			}
+		}
+	}
+}
+
+// stop disarms pending timeout
+func (r *execResource) stop() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
@@ -0,0 +1,188 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package estimator_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/akaspin/logx"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/agent/resource/estimator"
+	"github.com/da-moon/soil/fixture"
+	"github.com/da-moon/soil/manifest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// TestExec_HelperPlugin is plugin executed by TestExec
+func TestExec_HelperPlugin(t *testing.T) {
+	if os.Getenv("SOIL_TEST_EXEC_PLUGIN") != "1" {
+		return
+	}
+	next := 1
+	values := map[string]manifest.FlatMap{}
+	encoder := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req estimator.ExecRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(2)
+		}
+		switch req.Op {
+		case estimator.ExecOpCreate:
+			if req.Config["hang"] == true {
+				continue
+			}
+			if req.Values["value"] == "" {
+				req.Values = manifest.FlatMap{"value": strconv.Itoa(next)}
+				next++
+			}
+			values[req.Id] = manifest.FlatMap{"value": req.Values["value"]}
+			encoder.Encode(estimator.ExecResponse{Id: req.Id, Values: values[req.Id]})
+		case estimator.ExecOpUpdate:
+			if req.Config["crash"] == true {
+				os.Exit(1)
+			}
+			if req.Config["fail"] == true {
+				encoder.Encode(estimator.ExecResponse{Id: req.Id, Failure: "failed"})
+				continue
+			}
+			encoder.Encode(estimator.ExecResponse{Id: req.Id, Values: values[req.Id]})
+		case estimator.ExecOpDestroy:
+			delete(values, req.Id)
+		case estimator.ExecOpShutdown:
+			os.Exit(0)
+		}
+	}
+	os.Exit(0)
+}
+
+func TestExec(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := estimator.NewExec(estimator.GlobalConfig{}, estimator.Config{
+		Ctx: ctx,
+		Log: logx.GetLog("test"),
+		Provider: &allocation.Provider{
+			Kind: "exec",
+			Name: "plugin",
+			Config: map[string]interface{}{
+				"command": os.Args[0],
+				"args":    []interface{}{"-test.run=TestExec_HelperPlugin"},
+				"env":     "SOIL_TEST_EXEC_PLUGIN=1",
+				"timeout": "500ms",
+				"restart": "1s",
+			},
+		},
+	})
+	defer e.Close()
+	cons := consumeResults(ctx, e)
+	request := func(name string, config map[string]interface{}, values manifest.FlatMap) *allocation.Resource {
+		return &allocation.Resource{
+			Request: manifest.Resource{Provider: "plugin", Name: name, Config: config},
+			Values:  values,
+		}
+	}
+
+	t.Run("create", func(t *testing.T) {
+		e.Create("a", request("a", nil, nil))
+		e.Create("b", request("b", nil, manifest.FlatMap{"value": "5"}))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "1",
+				"b.allocated": "true",
+				"b.value":     "5",
+			}),
+		))
+	})
+	t.Run("failure", func(t *testing.T) {
+		e.Update("b", request("b", map[string]interface{}{"fail": true}, nil))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "1",
+				"b.allocated": "false",
+				"b.failure":   "failed",
+			}),
+		))
+	})
+	t.Run("crash", func(t *testing.T) {
+		e.Update("a", request("a", map[string]interface{}{"crash": true}, nil))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "false",
+				"a.failure":   "plugin exited: exit status 1",
+				"b.allocated": "false",
+				"b.failure":   "plugin exited: exit status 1",
+			}),
+		))
+	})
+	t.Run("restart", func(t *testing.T) {
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "1",
+				"b.allocated": "true",
+				"b.value":     "5",
+			}),
+		))
+	})
+	t.Run("timeout kills plugin", func(t *testing.T) {
+		e.Create("c", request("c", map[string]interface{}{"hang": true}, nil))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "false",
+				"a.failure":   "plugin exited: signal: killed",
+				"b.allocated": "false",
+				"b.failure":   "plugin exited: signal: killed",
+				"c.allocated": "false",
+				"c.failure":   "plugin exited: signal: killed",
+			}),
+		))
+	})
+	t.Run("restart after timeout", func(t *testing.T) {
+		e.Destroy("c")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "1",
+				"b.allocated": "true",
+				"b.value":     "5",
+			}),
+		))
+	})
+}
+
+func TestExec_BadConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := estimator.NewExec(estimator.GlobalConfig{}, estimator.Config{
+		Ctx: ctx,
+		Log: logx.GetLog("test"),
+		Provider: &allocation.Provider{
+			Kind: "exec",
+			Name: "plugin",
+			Config: map[string]interface{}{
+				"timeout": "never",
+			},
+		},
+	})
+	defer e.Close()
+	cons := consumeResults(ctx, e)
+	e.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "plugin", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "false",
+			"a.failure":   "2 errors occurred:\n\t* command is not defined\n\t* bad timeout: never\n\n",
+		}),
+	))
+}
@@ -0,0 +1,355 @@
+package estimator
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/da-moon/soil/manifest"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	IpamEstimator = "ipam" // ipam estimator name
+
+	ipamMaxSubnetSize = uint64(1) << 32
+)
+
+type ipamSubnet struct {
+	network *net.IPNet
+	base    *big.Int
+	size    uint64 // number of addresses limited by ipamMaxSubnetSize
+	gateway net.IP
+	bitmap  *roaring.Bitmap // used and reserved offsets
+}
+
+func newIpamSubnet(network *net.IPNet) (s *ipamSubnet) {
+	ones, bits := network.Mask.Size()
+	s = &ipamSubnet{
+		network: network,
+		base:    new(big.Int).SetBytes(network.IP),
+		size:    ipamMaxSubnetSize,
+		bitmap:  roaring.New(),
+	}
+	if bits-ones < 32 {
+		s.size = uint64(1) << uint(bits-ones)
+	}
+	// reserve network address and IPv4 broadcast
+	if s.size > 2 {
+		s.bitmap.Add(0)
+		if network.IP.To4() != nil {
+			s.bitmap.Add(uint32(s.size - 1))
+		}
+	}
+	return
+}
+
+func (s *ipamSubnet) prefix() (res int) {
+	res, _ = s.network.Mask.Size()
+	return
+}
+
+// address returns address by offset
+func (s *ipamSubnet) address(offset uint32) (res net.IP) {
+	raw := new(big.Int).Add(s.base, big.NewInt(int64(offset))).Bytes()
+	res = make(net.IP, len(s.network.IP))
+	copy(res[len(res)-len(raw):], raw)
+	return
+}
+
+// offset returns offset of given address in subnet
+func (s *ipamSubnet) offset(ip net.IP) (res uint32, ok bool) {
+	if ip = s.normalize(ip); ip == nil || !s.network.Contains(ip) {
+		return
+	}
+	diff := new(big.Int).Sub(new(big.Int).SetBytes(ip), s.base)
+	if !diff.IsUint64() || diff.Uint64() >= s.size {
+		return
+	}
+	res, ok = uint32(diff.Uint64()), true
+	return
+}
+
+// reserve marks addresses in given network as used
+func (s *ipamSubnet) reserve(network *net.IPNet) {
+	first, last := network.IP, lastAddress(network)
+	if s.normalize(first) == nil {
+		return
+	}
+	start, end := new(big.Int).SetBytes(s.normalize(first)), new(big.Int).SetBytes(s.normalize(last))
+	lo := new(big.Int).Sub(start, s.base)
+	hi := new(big.Int).Sub(end, s.base)
+	if lo.Sign() < 0 {
+		lo.SetInt64(0)
+	}
+	if max := new(big.Int).SetUint64(s.size - 1); hi.Cmp(max) > 0 {
+		hi = max
+	}
+	if lo.Cmp(hi) > 0 {
+		return
+	}
+	s.bitmap.AddRange(lo.Uint64(), hi.Uint64()+1)
+}
+
+func (s *ipamSubnet) normalize(ip net.IP) (res net.IP) {
+	if len(s.network.IP) == net.IPv4len {
+		res = ip.To4()
+		return
+	}
+	if ip.To4() == nil {
+		res = ip.To16()
+	}
+	return
+}
+
+// allocate returns first free offset
+func (s *ipamSubnet) allocate() (res uint32, err error) {
+	if ok := s.bitmap.CheckedAdd(0); ok {
+		return
+	}
+	iter := s.bitmap.Iterator()
+	for iter.HasNext() {
+		candidate := uint64(iter.Next()) + 1
+		if candidate >= s.size {
+			break
+		}
+		if ok := s.bitmap.CheckedAdd(uint32(candidate)); ok {
+			res = uint32(candidate)
+			return
+		}
+	}
+	err = ErrNotAvailable
+	return
+}
+
+type ipamAllocation struct {
+	subnet  int
+	offset  uint32
+	failure error
+}
+
+// Ipam allocates IPv4 and IPv6 addresses from configured CIDRs
+type Ipam struct {
+	*base
+	configErr error
+
+	subnets     []*ipamSubnet
+	total       uint64                    // number of addresses which can be allocated
+	allocations map[string]ipamAllocation // allocations by id
+}
+
+func NewIpam(globalConfig GlobalConfig, config Config) (r *Ipam) {
+	r = &Ipam{
+		allocations: map[string]ipamAllocation{},
+	}
+	r.configErr = r.configure(config.Provider.Config)
+	if scopeErr := config.nodeScopeOnly(); scopeErr != nil {
+		r.configErr = multierror.Append(r.configErr, scopeErr).ErrorOrNil()
+	}
+	r.base = newBase(globalConfig, config, r)
+	if r.configErr != nil {
+		r.log.Errorf(`bad config: %v`, r.configErr)
+	}
+	return
+}
+
+func (r *Ipam) configure(config map[string]interface{}) (err error) {
+	err = &multierror.Error{}
+	for _, raw := range toStrings(config["cidr"]) {
+		_, network, parseErr := net.ParseCIDR(raw)
+		if parseErr != nil {
+			err = multierror.Append(err, parseErr)
+			continue
+		}
+		r.subnets = append(r.subnets, newIpamSubnet(network))
+	}
+	if len(r.subnets) == 0 {
+		err = multierror.Append(err, fmt.Errorf(`cidr is not defined`))
+	}
+	for _, raw := range toStrings(config["gateway"]) {
+		ip := net.ParseIP(raw)
+		if ip == nil {
+			err = multierror.Append(err, fmt.Errorf(`bad gateway: %s`, raw))
+			continue
+		}
+		for _, subnet := range r.subnets {
+			if offset, ok := subnet.offset(ip); ok {
+				subnet.gateway = ip
+				subnet.bitmap.Add(offset)
+			}
+		}
+	}
+	for _, raw := range toStrings(config["exclude"]) {
+		network, parseErr := parseNetwork(raw)
+		if parseErr != nil {
+			err = multierror.Append(err, parseErr)
+			continue
+		}
+		for _, subnet := range r.subnets {
+			subnet.reserve(network)
+		}
+	}
+	for _, subnet := range r.subnets {
+		r.total += subnet.size - subnet.bitmap.GetCardinality()
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+// Total returns number of addresses which can be allocated
+func (r *Ipam) Total() (total uint64) {
+	total = r.total
+	return
+}
+
+func (r *Ipam) createFn(id string, config map[string]interface{}, values map[string]string) (res interface{}, err error) {
+	if r.configErr != nil {
+		r.notify(id, ipamAllocation{
+			failure: r.configErr,
+		})
+		return
+	}
+	if allocated, ok := r.allocations[id]; ok && allocated.failure == nil {
+		r.log.Tracef(`"%s" is already allocated: %v`, id, allocated)
+		return
+	}
+	if raw, ok := values["address"]; ok {
+		if ip := net.ParseIP(raw); ip == nil {
+			r.log.Warningf(`can't parse address: %s:%s`, id, raw)
+		} else {
+			for i, subnet := range r.subnets {
+				if offset, inSubnet := subnet.offset(ip); inSubnet && subnet.bitmap.CheckedAdd(offset) {
+					r.log.Tracef(`"%s" allocated from recovery: %s`, id, ip)
+					r.notify(id, ipamAllocation{
+						subnet: i,
+						offset: offset,
+					})
+					res = ip.String()
+					return
+				}
+			}
+			r.log.Warningf(`recovered address is not available: %s: %s`, id, raw)
+		}
+	}
+	res, err = r.try(id)
+	return
+}
+
+func (r *Ipam) updateFn(id string, config map[string]interface{}) (res interface{}, err error) {
+	state, ok := r.allocations[id]
+	if !ok {
+		err = fmt.Errorf(`not found: %s`, id)
+		return
+	}
+	if state.failure == nil {
+		err = fmt.Errorf(`already allocated: %s`, id)
+		return
+	}
+	if r.configErr != nil {
+		return
+	}
+	res, err = r.try(id)
+	return
+}
+
+func (r *Ipam) destroyFn(id string) (err error) {
+	state, ok := r.allocations[id]
+	if !ok {
+		err = fmt.Errorf(`not found: %s`, id)
+		return
+	}
+	if state.failure == nil {
+		r.subnets[state.subnet].bitmap.Remove(state.offset)
+	}
+	delete(r.allocations, id)
+	r.log.Tracef(`deallocated: %s: %v`, id, state)
+	r.send(id, nil, nil)
+
+	if r.configErr != nil {
+		return
+	}
+	for allocatedId, alloc := range r.allocations {
+		if alloc.failure != nil {
+			var res string
+			var reallocErr error
+			if res, reallocErr = r.try(allocatedId); reallocErr != nil {
+				r.log.Warningf(`fail to reallocate "%s": %v`, allocatedId, reallocErr)
+				continue
+			}
+			r.log.Infof(`reallocated %s: %s`, allocatedId, res)
+		}
+	}
+	return
+}
+
+func (r *Ipam) shutdownFn() (err error) {
+	return
+}
+
+func (r *Ipam) try(id string) (res string, err error) {
+	for i, subnet := range r.subnets {
+		var offset uint32
+		if offset, err = subnet.allocate(); err == nil {
+			r.notify(id, ipamAllocation{
+				subnet: i,
+				offset: offset,
+			})
+			res = subnet.address(offset).String()
+			return
+		}
+	}
+	err = ErrNotAvailable
+	r.notify(id, ipamAllocation{
+		failure: err,
+	})
+	return
+}
+
+func (r *Ipam) notify(id string, alloc ipamAllocation) {
+	r.allocations[id] = alloc
+	var values manifest.FlatMap
+	if alloc.failure == nil {
+		subnet := r.subnets[alloc.subnet]
+		values = manifest.FlatMap{
+			"address": subnet.address(alloc.offset).String(),
+			"prefix":  strconv.Itoa(subnet.prefix()),
+			"gateway": "",
+		}
+		if subnet.gateway != nil {
+			values["gateway"] = subnet.gateway.String()
+		}
+	}
+	r.send(id, alloc.failure, values)
+	r.log.Debugf(`downstream notified: %s:%v`, id, alloc)
+}
+
+// parseNetwork parses CIDR or single address
+func parseNetwork(raw string) (res *net.IPNet, err error) {
+	if strings.Contains(raw, "/") {
+		_, res, err = net.ParseCIDR(raw)
+		return
+	}
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		err = fmt.Errorf(`bad address: %s`, raw)
+		return
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		res = &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+		return
+	}
+	res = &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+	return
+}
+
+// lastAddress returns last address in network
+func lastAddress(network *net.IPNet) (res net.IP) {
+	res = make(net.IP, len(network.IP))
+	for i := range network.IP {
+		res[i] = network.IP[i] | ^network.Mask[i]
+	}
+	return
+}
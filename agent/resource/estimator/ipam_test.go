@@ -0,0 +1,101 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package estimator_test
+
+import (
+	"context"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/agent/resource/estimator"
+	"github.com/da-moon/soil/fixture"
+	"github.com/da-moon/soil/manifest"
+	"testing"
+)
+
+func TestIpam(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := estimator.NewIpam(estimator.GlobalConfig{}, newTestConfig(ctx, "ipam", "net", map[string]interface{}{
+		"cidr":    []interface{}{"10.0.0.0/29", "fd00::/126"},
+		"gateway": "10.0.0.1",
+		"exclude": []interface{}{"10.0.0.2", "10.0.0.6/32"},
+	}))
+	cons := consumeResults(ctx, r)
+	defer r.Close()
+
+	create := func(id string, values manifest.FlatMap) {
+		r.Create(id, &allocation.Resource{
+			Request: manifest.Resource{Provider: "net", Name: id},
+			Values:  values,
+		})
+	}
+	expect := map[string]string{}
+	allocated := func(id, address, prefix, gateway string) {
+		expect[id+".allocated"] = "true"
+		expect[id+".address"] = address
+		expect[id+".prefix"] = prefix
+		expect[id+".gateway"] = gateway
+		delete(expect, id+".failure")
+	}
+
+	t.Run("recovered", func(t *testing.T) {
+		create("a", manifest.FlatMap{"address": "10.0.0.4"})
+		allocated("a", "10.0.0.4", "29", "10.0.0.1")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("test", expect)))
+	})
+	t.Run("recovered excluded", func(t *testing.T) {
+		create("b", manifest.FlatMap{"address": "10.0.0.2"})
+		allocated("b", "10.0.0.3", "29", "10.0.0.1")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("test", expect)))
+	})
+	t.Run("fill up ipv4", func(t *testing.T) {
+		create("c", nil)
+		allocated("c", "10.0.0.5", "29", "10.0.0.1")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("test", expect)))
+	})
+	t.Run("ipv6", func(t *testing.T) {
+		create("d", nil)
+		allocated("d", "fd00::1", "126", "")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("test", expect)))
+		create("e", manifest.FlatMap{"address": "fd00::3"})
+		allocated("e", "fd00::3", "126", "")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("test", expect)))
+		create("f", nil)
+		allocated("f", "fd00::2", "126", "")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("test", expect)))
+	})
+	t.Run("not available", func(t *testing.T) {
+		create("g", nil)
+		expect["g.allocated"] = "false"
+		expect["g.failure"] = "not-available"
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("test", expect)))
+	})
+	t.Run("destroy reallocates", func(t *testing.T) {
+		r.Destroy("a")
+		for _, k := range []string{"allocated", "address", "prefix", "gateway"} {
+			delete(expect, "a."+k)
+		}
+		allocated("g", "10.0.0.4", "29", "10.0.0.1")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("test", expect)))
+	})
+}
+
+func TestIpam_BadConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := estimator.NewIpam(estimator.GlobalConfig{}, newTestConfig(ctx, "ipam", "net", map[string]interface{}{
+		"cidr": "10.0.0.0/33",
+	}))
+	cons := consumeResults(ctx, r)
+	defer r.Close()
+	r.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "net", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("test", map[string]string{
+		"a.allocated": "false",
+		"a.failure":   "2 errors occurred:\n\t* invalid CIDR address: 10.0.0.0/33\n\t* cidr is not defined\n\n",
+	})))
+}
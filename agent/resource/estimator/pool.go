@@ -0,0 +1,313 @@
+package estimator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/da-moon/soil/manifest"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	PoolEstimator = "pool" // pool estimator name
+
+	poolValuesSeparator = ","
+)
+
+type poolAllocation struct {
+	count   int
+	values  []string
+	pending int // updated count which doesn't fit yet
+	failure error
+}
+
+// Pool allocates named values from finite list declared by provider
+type Pool struct {
+	*base
+	configErr error
+	values    []string // declared values in order
+
+	used        map[string]string         // allocation id by value
+	allocations map[string]poolAllocation // allocations by id
+}
+
+func NewPool(globalConfig GlobalConfig, config Config) (p *Pool) {
+	p = &Pool{
+		used:        map[string]string{},
+		allocations: map[string]poolAllocation{},
+	}
+	err := &multierror.Error{}
+	seen := map[string]struct{}{}
+	for _, value := range toStrings(config.Provider.Config["values"]) {
+		if _, ok := seen[value]; ok || value == "" {
+			continue
+		}
+		if strings.Contains(value, poolValuesSeparator) {
+			err = multierror.Append(err, fmt.Errorf(`value contains "%s": %s`, poolValuesSeparator, value))
+			continue
+		}
+		seen[value] = struct{}{}
+		p.values = append(p.values, value)
+	}
+	if scopeErr := config.nodeScopeOnly(); scopeErr != nil {
+		err = multierror.Append(err, scopeErr)
+	}
+	p.configErr = err.ErrorOrNil()
+	p.base = newBase(globalConfig, config, p)
+	if p.configErr != nil {
+		p.log.Errorf(`bad config: %v`, p.configErr)
+	}
+	return
+}
+
+// Total returns number of declared values
+func (p *Pool) Total() (total uint64) {
+	total = uint64(len(p.values))
+	return
+}
+
+func (p *Pool) createFn(id string, config map[string]interface{}, values map[string]string) (res interface{}, err error) {
+	if allocated, ok := p.allocations[id]; ok && allocated.failure == nil {
+		p.log.Tracef(`"%s" is already allocated: %v`, id, allocated.values)
+		return
+	}
+	count, err := poolCount(config)
+	if err == nil {
+		err = p.configErr
+	}
+	if err != nil {
+		p.notify(id, poolAllocation{
+			failure: err,
+		})
+		return
+	}
+
+	// try to find recovered values
+	raw, ok := values["values"]
+	if !ok {
+		raw, ok = values["value"]
+	}
+	if ok {
+		recovered := strings.Split(raw, poolValuesSeparator)
+		if p.isAvailable(count, recovered...) {
+			p.log.Tracef(`"%s" allocated from recovery: %v`, id, recovered)
+			p.notify(id, poolAllocation{
+				count:  count,
+				values: recovered,
+			})
+			res = recovered
+			return
+		}
+		p.log.Warningf(`recovered values are not available: %s: %s`, id, raw)
+	}
+	res, err = p.try(id, count)
+	return
+}
+
+func (p *Pool) updateFn(id string, config map[string]interface{}) (res interface{}, err error) {
+	state, ok := p.allocations[id]
+	if !ok {
+		err = fmt.Errorf(`not found: %s`, id)
+		return
+	}
+	count, err := poolCount(config)
+	if err != nil {
+		p.release(id)
+		p.notify(id, poolAllocation{
+			failure: err,
+		})
+		return
+	}
+	if state.failure == nil && state.count == count {
+		state.pending = 0
+		p.allocations[id] = state
+		err = fmt.Errorf(`already allocated: %s`, id)
+		return
+	}
+	// keep allocated values until new count fits
+	if state.failure == nil && !p.fits(count, state.values) {
+		p.log.Warningf(`update of %s is pending: %v`, id, ErrNotAvailable)
+		state.pending = count
+		p.allocations[id] = state
+		return
+	}
+	p.release(id)
+	res, err = p.try(id, count)
+	return
+}
+
+func (p *Pool) destroyFn(id string) (err error) {
+	state, ok := p.allocations[id]
+	if !ok {
+		err = fmt.Errorf(`not found: %s`, id)
+		return
+	}
+	p.release(id)
+	delete(p.allocations, id)
+	p.log.Tracef(`deallocated: %s: %v`, id, state)
+	p.send(id, nil, nil)
+
+	for allocatedId, alloc := range p.allocations {
+		switch {
+		case alloc.failure != nil && alloc.count > 0:
+			var res []string
+			var reallocErr error
+			if res, reallocErr = p.try(allocatedId, alloc.count); reallocErr != nil {
+				p.log.Warningf(`fail to reallocate "%s": %v`, allocatedId, reallocErr)
+				continue
+			}
+			p.log.Infof(`reallocated %s: %v`, allocatedId, res)
+		case alloc.failure == nil && alloc.pending > 0:
+			if !p.fits(alloc.pending, alloc.values) {
+				continue
+			}
+			p.release(allocatedId)
+			var res []string
+			var updateErr error
+			if res, updateErr = p.try(allocatedId, alloc.pending); updateErr != nil {
+				p.log.Warningf(`fail to update "%s": %v`, allocatedId, updateErr)
+				continue
+			}
+			p.log.Infof(`updated %s: %v`, allocatedId, res)
+		}
+	}
+	return
+}
+
+func (p *Pool) shutdownFn() (err error) {
+	return
+}
+
+// isAvailable returns true if exactly count of distinct declared and unused
+// values are given
+func (p *Pool) isAvailable(count int, values ...string) (ok bool) {
+	if len(values) != count {
+		return
+	}
+	seen := map[string]struct{}{}
+	for _, value := range values {
+		if _, dup := seen[value]; dup {
+			return
+		}
+		seen[value] = struct{}{}
+		if _, used := p.used[value]; used || !p.isDeclared(value) {
+			return
+		}
+	}
+	ok = true
+	return
+}
+
+func (p *Pool) isDeclared(value string) (ok bool) {
+	for _, declared := range p.values {
+		if declared == value {
+			ok = true
+			return
+		}
+	}
+	return
+}
+
+// fits returns true if count of values can be allocated when replaced
+// values are freed
+func (p *Pool) fits(count int, replaced []string) (ok bool) {
+	ok = count <= len(p.values)-len(p.used)+len(replaced)
+	return
+}
+
+// release frees values allocated by id
+func (p *Pool) release(id string) {
+	for _, value := range p.allocations[id].values {
+		delete(p.used, value)
+	}
+}
+
+func (p *Pool) try(id string, count int) (res []string, err error) {
+	for _, value := range p.values {
+		if len(res) == count {
+			break
+		}
+		if _, used := p.used[value]; !used {
+			res = append(res, value)
+		}
+	}
+	if len(res) < count {
+		res = nil
+		err = ErrNotAvailable
+		p.notify(id, poolAllocation{
+			count:   count,
+			failure: err,
+		})
+		return
+	}
+	p.notify(id, poolAllocation{
+		count:  count,
+		values: res,
+	})
+	return
+}
+
+func (p *Pool) notify(id string, alloc poolAllocation) {
+	for _, value := range alloc.values {
+		p.used[value] = id
+	}
+	p.allocations[id] = alloc
+	var values manifest.FlatMap
+	if alloc.failure == nil {
+		values = manifest.FlatMap{
+			"value":  alloc.values[0],
+			"values": strings.Join(alloc.values, poolValuesSeparator),
+		}
+	}
+	p.send(id, alloc.failure, values)
+	p.log.Debugf(`downstream notified: %s:%v`, id, alloc)
+}
+
+// poolCount returns requested count of values. Default is one.
+func poolCount(config map[string]interface{}) (res int, err error) {
+	res = 1
+	raw, ok := config["count"]
+	if !ok {
+		return
+	}
+	switch v := raw.(type) {
+	case int:
+		res = v
+	case float64:
+		res = int(v)
+	case string:
+		if res, err = strconv.Atoi(v); err != nil {
+			err = fmt.Errorf(`bad count: %s`, v)
+			return
+		}
+	default:
+		err = fmt.Errorf(`bad count: %v`, raw)
+		return
+	}
+	if res < 1 {
+		err = fmt.Errorf(`bad count: %d`, res)
+	}
+	return
+}
+
+// toStrings converts list, comma-separated string or scalar to slice of
+// strings
+func toStrings(raw interface{}) (res []string) {
+	switch v := raw.(type) {
+	case []string:
+		res = v
+	case []interface{}:
+		for _, item := range v {
+			res = append(res, fmt.Sprint(item))
+		}
+	case string:
+		for _, item := range strings.Split(v, poolValuesSeparator) {
+			res = append(res, strings.TrimSpace(item))
+		}
+	case nil:
+	default:
+		res = []string{fmt.Sprint(v)}
+	}
+	return
+}
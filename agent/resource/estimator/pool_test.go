@@ -0,0 +1,172 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package estimator_test
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/agent/resource/estimator"
+	"github.com/da-moon/soil/fixture"
+	"github.com/da-moon/soil/manifest"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := estimator.NewPool(estimator.GlobalConfig{}, estimator.Config{
+		Ctx: ctx,
+		Log: logx.GetLog("test"),
+		Provider: &allocation.Provider{
+			Kind: "pool",
+			Name: "gpu",
+			Config: map[string]interface{}{
+				"values": []interface{}{"gpu0", "gpu1", "gpu2", "gpu3"},
+			},
+		},
+	})
+	defer p.Close()
+	cons := consumeResults(ctx, p)
+
+	t.Run("recovered", func(t *testing.T) {
+		p.Create("a", &allocation.Resource{
+			Request: manifest.Resource{Provider: "gpu", Name: "a"},
+			Values:  manifest.FlatMap{"value": "gpu2"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "gpu2",
+				"a.values":    "gpu2",
+			}),
+		))
+	})
+	t.Run("recovered not declared", func(t *testing.T) {
+		p.Create("b", &allocation.Resource{
+			Request: manifest.Resource{Provider: "gpu", Name: "b"},
+			Values:  manifest.FlatMap{"value": "gpu9"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "gpu2",
+				"a.values":    "gpu2",
+				"b.allocated": "true",
+				"b.value":     "gpu0",
+				"b.values":    "gpu0",
+			}),
+		))
+	})
+	t.Run("count", func(t *testing.T) {
+		p.Create("c", &allocation.Resource{
+			Request: manifest.Resource{Provider: "gpu", Name: "c", Config: map[string]interface{}{"count": 2}},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "gpu2",
+				"a.values":    "gpu2",
+				"b.allocated": "true",
+				"b.value":     "gpu0",
+				"b.values":    "gpu0",
+				"c.allocated": "true",
+				"c.value":     "gpu1",
+				"c.values":    "gpu1,gpu3",
+			}),
+		))
+	})
+	t.Run("not available", func(t *testing.T) {
+		p.Create("d", &allocation.Resource{
+			Request: manifest.Resource{Provider: "gpu", Name: "d"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "gpu2",
+				"a.values":    "gpu2",
+				"b.allocated": "true",
+				"b.value":     "gpu0",
+				"b.values":    "gpu0",
+				"c.allocated": "true",
+				"c.value":     "gpu1",
+				"c.values":    "gpu1,gpu3",
+				"d.allocated": "false",
+				"d.failure":   "not-available",
+			}),
+		))
+	})
+	t.Run("destroy reallocates", func(t *testing.T) {
+		p.Destroy("a")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"b.allocated": "true",
+				"b.value":     "gpu0",
+				"b.values":    "gpu0",
+				"c.allocated": "true",
+				"c.value":     "gpu1",
+				"c.values":    "gpu1,gpu3",
+				"d.allocated": "true",
+				"d.value":     "gpu2",
+				"d.values":    "gpu2",
+			}),
+		))
+	})
+	t.Run("update count", func(t *testing.T) {
+		p.Update("c", &allocation.Resource{
+			Request: manifest.Resource{Provider: "gpu", Name: "c", Config: map[string]interface{}{"count": 1}},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"b.allocated": "true",
+				"b.value":     "gpu0",
+				"b.values":    "gpu0",
+				"c.allocated": "true",
+				"c.value":     "gpu1",
+				"c.values":    "gpu1",
+				"d.allocated": "true",
+				"d.value":     "gpu2",
+				"d.values":    "gpu2",
+			}),
+		))
+	})
+	t.Run("update keeps values", func(t *testing.T) {
+		p.Update("b", &allocation.Resource{
+			Request: manifest.Resource{Provider: "gpu", Name: "b", Config: map[string]interface{}{"count": 3}},
+		})
+		p.Destroy("d")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"b.allocated": "true",
+				"b.value":     "gpu0",
+				"b.values":    "gpu0,gpu2,gpu3",
+				"c.allocated": "true",
+				"c.value":     "gpu1",
+				"c.values":    "gpu1",
+			}),
+		))
+	})
+}
+
+func TestPool_BadValues(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := estimator.NewPool(estimator.GlobalConfig{}, newTestConfig(ctx, "pool", "gpu", map[string]interface{}{
+		"values": []interface{}{"gpu0", "gpu1,gpu2"},
+	}))
+	cons := consumeResults(ctx, p)
+	defer p.Close()
+	p.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "gpu", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "false",
+			"a.failure":   "1 error occurred:\n\t* value contains \",\": gpu1,gpu2\n\n",
+		}),
+	))
+}
@@ -0,0 +1,120 @@
+package estimator
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	PortEstimator = "port" // port estimator name
+
+	PortStrategySequential = RangeStrategySequential
+	PortStrategyRandom     = RangeStrategyRandom
+
+	defaultPortMin = 1024
+	defaultPortMax = 65535
+)
+
+// Port allocates ports from range which are not bound on host. Recovered
+// and new ports are probed by binding on configured address. Busy
+// recovered port is kept if units of owning pod are active.
+type Port struct {
+	*Range
+
+	address   string
+	protocols []string
+	pods      PodChecker
+}
+
+func NewPort(globalConfig GlobalConfig, config Config) (p *Port) {
+	p = &Port{
+		Range:     newRange(),
+		protocols: []string{"tcp"},
+		pods:      globalConfig.Pods,
+	}
+	p.Range.configureScope(globalConfig, config)
+	p.Range.configureRange(config.Provider.Config, defaultPortMin, defaultPortMax)
+	if configErr := p.configure(config.Provider.Config); configErr != nil {
+		p.configErr = multierror.Append(p.configErr, configErr).ErrorOrNil()
+	}
+	p.Range.accept = p.accept
+	p.Range.acceptRecovered = p.acceptRecovered
+	p.Range.base = newBase(globalConfig, config, p.Range)
+	if p.configErr != nil {
+		p.log.Errorf(`bad config: %v`, p.configErr)
+	}
+	return
+}
+
+func (p *Port) configure(config map[string]interface{}) (err error) {
+	err = &multierror.Error{}
+	if !p.available.IsEmpty() && p.available.Maximum() > defaultPortMax {
+		err = multierror.Append(err, fmt.Errorf(`port %d is greater than %d`, p.available.Maximum(), defaultPortMax))
+	}
+	if raw, ok := config["address"]; ok {
+		p.address = fmt.Sprint(raw)
+	}
+	if raw, ok := config["protocol"]; ok {
+		p.protocols = toStrings(raw)
+	}
+	for _, protocol := range p.protocols {
+		if protocol != "tcp" && protocol != "udp" {
+			err = multierror.Append(err, fmt.Errorf(`bad protocol: %s`, protocol))
+		}
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+// accept returns true if port can be bound
+func (p *Port) accept(value uint32) (ok bool) {
+	if probeErr := p.probe(value); probeErr != nil {
+		p.log.Debugf(`skip busy port %d: %v`, value, probeErr)
+		return
+	}
+	ok = true
+	return
+}
+
+// acceptRecovered returns true if recovered port can be bound or is bound
+// by active pod
+func (p *Port) acceptRecovered(id string, value uint32) (ok bool) {
+	probeErr := p.probe(value)
+	if probeErr == nil {
+		ok = true
+		return
+	}
+	if pod := strings.LastIndex(id, "."); pod > 0 && p.pods != nil && p.pods.IsActive(id[:pod]) {
+		p.log.Debugf(`recovered port %d is bound by active pod: %s`, value, id)
+		ok = true
+		return
+	}
+	p.log.Debugf(`skip busy recovered port %d: %s: %v`, value, id, probeErr)
+	return
+}
+
+// probe binds port with all configured protocols
+func (p *Port) probe(value uint32) (err error) {
+	address := net.JoinHostPort(p.address, strconv.FormatUint(uint64(value), 10))
+	for _, protocol := range p.protocols {
+		switch protocol {
+		case "tcp":
+			var ln net.Listener
+			if ln, err = net.Listen("tcp", address); err != nil {
+				return
+			}
+			ln.Close()
+		case "udp":
+			var conn net.PacketConn
+			if conn, err = net.ListenPacket("udp", address); err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}
+	return
+}
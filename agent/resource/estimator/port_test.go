@@ -0,0 +1,184 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package estimator_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/agent/resource/estimator"
+	"github.com/da-moon/soil/fixture"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+// listen binds free port which is followed by two ports in valid range
+func listen(t *testing.T) (ln net.Listener, port int) {
+	for {
+		var err error
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		if port = ln.Addr().(*net.TCPAddr).Port; port+2 <= 65535 {
+			return
+		}
+		ln.Close()
+	}
+}
+
+func TestPort(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, busy := listen(t)
+	defer ln.Close()
+
+	p := estimator.NewPort(estimator.GlobalConfig{}, newTestConfig(ctx, "port", "port", map[string]interface{}{
+		"min":     busy,
+		"max":     float64(busy + 2),
+		"address": "127.0.0.1",
+		"exclude": []interface{}{busy + 1},
+	}))
+	cons := consumeResults(ctx, p)
+	defer p.Close()
+
+	t.Run("recovered busy", func(t *testing.T) {
+		p.Create("a", &allocation.Resource{
+			Request: manifest.Resource{Provider: "port", Name: "a"},
+			Values:  manifest.FlatMap{"value": fmt.Sprint(busy)},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     fmt.Sprint(busy + 2),
+			}),
+		))
+	})
+	t.Run("not available", func(t *testing.T) {
+		p.Create("b", &allocation.Resource{
+			Request: manifest.Resource{Provider: "port", Name: "b"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     fmt.Sprint(busy + 2),
+				"b.allocated": "false",
+				"b.failure":   "not-available",
+			}),
+		))
+	})
+	t.Run("released by host", func(t *testing.T) {
+		ln.Close()
+		p.Destroy("a")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"b.allocated": "true",
+				"b.value":     fmt.Sprint(busy),
+			}),
+		))
+	})
+	t.Run("recovered from __values", func(t *testing.T) {
+		p.Create("c", &allocation.Resource{
+			Request: manifest.Resource{Provider: "port", Name: "c"},
+			Values:  manifest.FlatMap{"__values": fmt.Sprintf(`{"allocated":"true","value":"%d"}`, busy+2)},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"b.allocated": "true",
+				"b.value":     fmt.Sprint(busy),
+				"c.allocated": "true",
+				"c.value":     fmt.Sprint(busy + 2),
+			}),
+		))
+	})
+}
+
+type testingPods map[string]bool
+
+func (p testingPods) IsActive(name string) (ok bool) {
+	ok = p[name]
+	return
+}
+
+func TestPort_RecoveredActive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, busy := listen(t)
+	defer ln.Close()
+
+	p := estimator.NewPort(estimator.GlobalConfig{Pods: testingPods{"active": true}}, newTestConfig(ctx, "port", "port", map[string]interface{}{
+		"min":     busy,
+		"max":     busy + 2,
+		"address": "127.0.0.1",
+	}))
+	cons := consumeResults(ctx, p)
+	defer p.Close()
+
+	p.Create("stopped.a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "port", Name: "a"},
+		Values:  manifest.FlatMap{"value": fmt.Sprint(busy)},
+	})
+	p.Create("active.a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "port", Name: "a"},
+		Values:  manifest.FlatMap{"value": fmt.Sprint(busy)},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"active.a.allocated":  "true",
+			"active.a.value":      fmt.Sprint(busy),
+			"stopped.a.allocated": "true",
+			"stopped.a.value":     fmt.Sprint(busy + 1),
+		}),
+	))
+}
+
+func TestPort_Random(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, busy := listen(t)
+	defer ln.Close()
+
+	p := estimator.NewPort(estimator.GlobalConfig{}, newTestConfig(ctx, "port", "port", map[string]interface{}{
+		"min":      busy,
+		"max":      busy + 1,
+		"address":  "127.0.0.1",
+		"protocol": []interface{}{"tcp", "udp"},
+		"strategy": "random",
+	}))
+	cons := consumeResults(ctx, p)
+	defer p.Close()
+	p.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "port", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "true",
+			"a.value":     fmt.Sprint(busy + 1),
+		}),
+	))
+}
+
+func TestPort_BadConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := estimator.NewPort(estimator.GlobalConfig{}, newTestConfig(ctx, "port", "port", map[string]interface{}{
+		"protocol": "sctp",
+	}))
+	cons := consumeResults(ctx, p)
+	defer p.Close()
+	p.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "port", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "false",
+			"a.failure":   "1 error occurred:\n\t* bad protocol: sctp\n\n",
+		}),
+	))
+}
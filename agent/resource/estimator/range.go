@@ -1,39 +1,169 @@
 package estimator
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/RoaringBitmap/roaring"
+	"github.com/da-moon/soil/agent/allocation"
 	"github.com/da-moon/soil/manifest"
+	"github.com/hashicorp/go-multierror"
+	"hash/fnv"
+	"math"
+	"math/rand"
 	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	RangeStrategyLowest     = "lowest"      // allocate lowest free value
+	RangeStrategySequential = "sequential"  // alias for "lowest"
+	RangeStrategyRandom     = "random"      // start search from random value
+	RangeStrategyStickyHash = "sticky-hash" // start search from value chosen by resource id hash
+
+	claimPrefix = "resource/claims"
+)
+
+// claimRetryInterval is interval to retry failed cluster scoped allocations
+var claimRetryInterval = time.Second * 10
+
+// claimAttempts is maximum number of values claimed by one allocation try
+var claimAttempts = 16
+
 type rangeExecutorAllocation struct {
 	value   uint32
 	failure error
+	pending bool // recovered value waits for claim
 }
 
+// Range allocates values from configured ranges. Free values are kept in
+// bitmap to find candidate in logarithmic time.
 type Range struct {
 	*base
-	min uint32
-	max uint32
 
-	bitmap      *roaring.Bitmap
+	available   *roaring.Bitmap                    // configured values
+	free        *roaring.Bitmap                    // available values which are not allocated
+	total       uint64                             // number of available values
+	strategy    string                             // allocation strategy
+	random      *rand.Rand                         // random source for "random" strategy
 	allocations map[string]rangeExecutorAllocation // allocation requests by id
+
+	accept          func(value uint32) bool                                 // optional check of candidates
+	acceptRecovered func(id string, value uint32) bool                      // optional check of recovered values instead of accept
+	valuesFn        func(id string, value uint32) (manifest.FlatMap, error) // optional additional values
+	releaseFn       func(id string, value uint32)                           // optional cleanup on destroy
+	configErr       error
+
+	claimer  Claimer                // claims values for cluster scope
+	claimKey string                 // claims prefix
+	retries  map[string]*time.Timer // pending claim retries by id
 }
 
 func NewRange(globalConfig GlobalConfig, config Config) (r *Range) {
+	r = newRange()
+	r.configureScope(globalConfig, config)
+	r.configureRange(config.Provider.Config, 0, math.MaxUint32)
+	r.base = newBase(globalConfig, config, r)
+	if r.configErr != nil {
+		r.log.Errorf(`bad config: %v`, r.configErr)
+	}
+	return
+}
+
+// Total returns number of values which can be allocated
+func (r *Range) Total() (total uint64) {
+	total = r.total
+	return
+}
+
+func newRange() (r *Range) {
 	r = &Range{
-		bitmap:      roaring.New(),
+		available:   roaring.New(),
+		free:        roaring.New(),
+		strategy:    RangeStrategyLowest,
 		allocations: map[string]rangeExecutorAllocation{},
+		retries:     map[string]*time.Timer{},
 	}
-	if v, ok := config.Provider.Config["min"]; ok {
-		r.min = uint32(v.(int))
+	return
+}
+
+// configureRange configures available values and strategy. Values are
+// defined by "min" and "max" or by "ranges" list. Errors are appended to
+// configErr.
+func (r *Range) configureRange(config map[string]interface{}, min, max uint32) {
+	err := &multierror.Error{}
+	for _, bound := range []struct {
+		key   string
+		value *uint32
+	}{{"min", &min}, {"max", &max}} {
+		raw, ok := config[bound.key]
+		if !ok {
+			continue
+		}
+		if *bound.value, ok = toUint32(raw); !ok {
+			err = multierror.Append(err, fmt.Errorf(`bad %s: %v`, bound.key, raw))
+		}
 	}
-	if v, ok := config.Provider.Config["max"]; ok {
-		r.max = uint32(v.(int))
+	if raw, ok := config["ranges"]; ok {
+		_, minOk := config["min"]
+		_, maxOk := config["max"]
+		if minOk || maxOk {
+			err = multierror.Append(err, fmt.Errorf(`ranges can't be used with min or max`))
+		}
+		for _, item := range toStrings(raw) {
+			from, to, parseErr := parseValueRange(item)
+			if parseErr != nil {
+				err = multierror.Append(err, fmt.Errorf(`bad range: %s`, item))
+				continue
+			}
+			r.available.AddRange(uint64(from), uint64(to)+1)
+		}
+	} else if min > max {
+		err = multierror.Append(err, fmt.Errorf(`min %d is greater than max %d`, min, max))
+	} else {
+		r.available.AddRange(uint64(min), uint64(max)+1)
 	}
-	r.base = newBase(globalConfig, config, r)
-	return
+	for _, item := range toStrings(config["exclude"]) {
+		from, to, parseErr := parseValueRange(item)
+		if parseErr != nil {
+			err = multierror.Append(err, fmt.Errorf(`bad exclude: %s`, item))
+			continue
+		}
+		r.available.RemoveRange(uint64(from), uint64(to)+1)
+	}
+	switch strategy := fmt.Sprint(config["strategy"]); strategy {
+	case RangeStrategyLowest, RangeStrategySequential, "<nil>":
+	case RangeStrategyRandom:
+		r.strategy = strategy
+		r.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	case RangeStrategyStickyHash:
+		r.strategy = strategy
+	default:
+		err = multierror.Append(err, fmt.Errorf(`bad strategy: %s`, strategy))
+	}
+	r.free = r.available.Clone()
+	r.total = r.available.GetCardinality()
+	if err.ErrorOrNil() != nil {
+		r.configErr = multierror.Append(r.configErr, err.Errors...).ErrorOrNil()
+	}
+}
+
+// configureScope enables claims for cluster scoped provider
+func (r *Range) configureScope(globalConfig GlobalConfig, config Config) {
+	scope, err := config.scope()
+	if err != nil {
+		r.configErr = err
+		return
+	}
+	if scope != ScopeCluster {
+		return
+	}
+	if globalConfig.Claimer == nil {
+		r.configErr = fmt.Errorf(`cluster scope is not available`)
+		return
+	}
+	r.claimer = globalConfig.Claimer
+	r.claimKey = strings.Join([]string{claimPrefix, config.Id}, "/")
 }
 
 func (r *Range) createFn(id string, config map[string]interface{}, values map[string]string) (res interface{}, err error) {
@@ -42,26 +172,28 @@ func (r *Range) createFn(id string, config map[string]interface{}, values map[st
 	if allocated, ok := r.allocations[id]; ok && allocated.failure == nil {
 		r.log.Tracef(`"id" is already allocated: %d`, allocated.value)
 		return
+	} else if ok && allocated.pending {
+		r.cancelRetry(id)
+		res, err = r.claimRecovered(id, allocated.value)
+		return
 	}
 
 	// try to find recovered value
 	var recoveredValue uint32
 
-	if raw, ok := values["value"]; ok {
+	if raw, ok := recoveredRaw(values); ok {
 		if parsed, parseErr := strconv.ParseUint(raw, 10, 32); parseErr != nil {
 			r.log.Warningf(`can't parse value: %s:%s`, id, raw)
 		} else {
-			if recoveredValue = uint32(parsed); recoveredValue >= r.min && recoveredValue <= r.max {
-				if ok = r.bitmap.CheckedAdd(recoveredValue); ok {
-					r.log.Tracef(`"%s" allocated from recovery: %d`, id, recoveredValue)
-					r.notify(id, rangeExecutorAllocation{
-						value: recoveredValue,
-					})
-					res = recoveredValue
+			if recoveredValue = uint32(parsed); r.available.Contains(recoveredValue) {
+				if r.configErr != nil || !r.isRecoveredAccepted(id, recoveredValue) {
+					r.log.Warningf(`recovered value is not accepted: %s: %d`, id, recoveredValue)
+				} else if ok = r.free.CheckedRemove(recoveredValue); ok {
+					res, err = r.claimRecovered(id, recoveredValue)
 					return
 				}
 			} else {
-				r.log.Warningf(`recovered value exceeds limits: %s: %d(min) < %d < %d(max)`, id, r.min, recoveredValue, r.max)
+				r.log.Warningf(`recovered value is not in range: %s: %d`, id, recoveredValue)
 			}
 		}
 	}
@@ -69,6 +201,19 @@ func (r *Range) createFn(id string, config map[string]interface{}, values map[st
 	return
 }
 
+// isRecoveredAccepted checks recovered value with acceptRecovered or accept
+func (r *Range) isRecoveredAccepted(id string, value uint32) (ok bool) {
+	switch {
+	case r.acceptRecovered != nil:
+		ok = r.acceptRecovered(id, value)
+	case r.accept != nil:
+		ok = r.accept(value)
+	default:
+		ok = true
+	}
+	return
+}
+
 func (r *Range) updateFn(id string, config map[string]interface{}) (res interface{}, err error) {
 	var state rangeExecutorAllocation
 	var ok bool
@@ -80,6 +225,11 @@ func (r *Range) updateFn(id string, config map[string]interface{}) (res interfac
 		err = fmt.Errorf(`already allocated: %s`, id)
 		return
 	}
+	r.cancelRetry(id)
+	if state.pending {
+		res, err = r.claimRecovered(id, state.value)
+		return
+	}
 	res, err = r.try(id)
 	return
 }
@@ -92,15 +242,22 @@ func (r *Range) destroyFn(id string) (err error) {
 		return
 	}
 
+	r.cancelRetry(id)
 	if state.failure == nil {
-		r.bitmap.Remove(state.value)
+		if r.releaseFn != nil {
+			r.releaseFn(id, state.value)
+		}
+		r.free.Add(state.value)
+		r.release(state.value)
+	} else if state.pending {
+		r.free.Add(state.value)
 	}
 	delete(r.allocations, id)
 	r.log.Tracef(`deallocated: %s: %v`, id, state)
 	r.send(id, nil, nil)
 
 	for allocatedId, alloc := range r.allocations {
-		if alloc.failure != nil {
+		if alloc.failure != nil && !alloc.pending {
 			var res uint32
 			var reallocErr error
 			if res, reallocErr = r.try(allocatedId); reallocErr != nil {
@@ -114,40 +271,166 @@ func (r *Range) destroyFn(id string) (err error) {
 }
 
 func (r *Range) notify(id string, alloc rangeExecutorAllocation) {
-	r.allocations[id] = alloc
-	r.send(id, alloc.failure, manifest.FlatMap{
+	values := manifest.FlatMap{
 		"value": fmt.Sprintf("%d", alloc.value),
-	})
+	}
+	if alloc.failure == nil && r.valuesFn != nil {
+		extra, err := r.valuesFn(id, alloc.value)
+		if err != nil {
+			r.free.Add(alloc.value)
+			r.release(alloc.value)
+			alloc = rangeExecutorAllocation{
+				failure: err,
+			}
+		}
+		values = values.Merge(extra)
+	}
+	r.allocations[id] = alloc
+	r.send(id, alloc.failure, values)
 	r.log.Debugf(`downstream notified: %s:%v`, id, alloc)
 }
 
 func (r *Range) try(id string) (res uint32, err error) {
-	res, err = r.allocateBitmap()
+	if err = r.configErr; err == nil {
+		// values claimed by other nodes are skipped until next try
+		var rejected []uint32
+		for {
+			if len(rejected) >= claimAttempts {
+				err = ErrNotAvailable
+				break
+			}
+			if res, err = r.allocate(id); err != nil {
+				break
+			}
+			var claimed bool
+			if claimed, err = r.claim(id, res); claimed {
+				break
+			}
+			if err != nil {
+				r.free.Add(res)
+				break
+			}
+			r.log.Debugf(`value %d is claimed by another node`, res)
+			rejected = append(rejected, res)
+		}
+		for _, value := range rejected {
+			r.free.Add(value)
+		}
+	}
 	if err != nil {
 		r.notify(id, rangeExecutorAllocation{
 			failure: err,
 		})
+		r.retry(id)
 		return
 	}
+	r.cancelRetry(id)
 	r.notify(id, rangeExecutorAllocation{
 		value: res,
 	})
 	return
 }
 
-func (r *Range) allocateBitmap() (res uint32, err error) {
-	if ok := r.bitmap.CheckedAdd(r.min); ok {
-		res = r.min
+// claimRecovered claims recovered value which is already taken from free
+// values. Value is kept while claimer is not ready and released to try
+// other values if it is claimed by another node.
+func (r *Range) claimRecovered(id string, value uint32) (res uint32, err error) {
+	claimed, claimErr := r.claim(id, value)
+	if claimErr != nil {
+		r.log.Warningf(`recovered value is not claimed: %s: %d: %v`, id, value, claimErr)
+		err = claimErr
+		r.notify(id, rangeExecutorAllocation{
+			value:   value,
+			failure: err,
+			pending: true,
+		})
+		r.retry(id)
 		return
 	}
-	iter := r.bitmap.Iterator()
-	for iter.HasNext() {
-		candidate := iter.Next() + 1
-		if candidate > r.max {
-			err = ErrNotAvailable
-			return
+	if !claimed {
+		r.log.Warningf(`recovered value is claimed by another node: %s: %d`, id, value)
+		r.free.Add(value)
+		res, err = r.try(id)
+		return
+	}
+	r.log.Tracef(`"%s" allocated from recovery: %d`, id, value)
+	r.notify(id, rangeExecutorAllocation{
+		value: value,
+	})
+	res = value
+	return
+}
+
+// claim claims value in cluster for cluster scoped provider
+func (r *Range) claim(id string, value uint32) (ok bool, err error) {
+	if r.claimer == nil {
+		ok = true
+		return
+	}
+	ok, err = r.claimer.Claim(r.claimKey+"/"+strconv.FormatUint(uint64(value), 10), []byte(id))
+	return
+}
+
+// release releases claimed value
+func (r *Range) release(value uint32) {
+	if r.claimer == nil {
+		return
+	}
+	if err := r.claimer.Release(r.claimKey + "/" + strconv.FormatUint(uint64(value), 10)); err != nil {
+		r.log.Warningf(`can't release %d: %v`, value, err)
+	}
+}
+
+// retry schedules update of failed cluster scoped allocation. Only one
+// retry is scheduled for each id.
+func (r *Range) retry(id string) {
+	if r.claimer == nil {
+		return
+	}
+	if _, ok := r.retries[id]; ok {
+		return
+	}
+	r.retries[id] = time.AfterFunc(claimRetryInterval, func() {
+		r.base.Update(id, &allocation.Resource{})
+	})
+}
+
+// cancelRetry cancels scheduled retry
+func (r *Range) cancelRetry(id string) {
+	if timer, ok := r.retries[id]; ok {
+		timer.Stop()
+		delete(r.retries, id)
+	}
+}
+
+// allocate takes first free and accepted value starting from value
+// chosen by strategy
+func (r *Range) allocate(id string) (res uint32, err error) {
+	var start uint32
+	if card := r.available.GetCardinality(); card > 0 {
+		switch r.strategy {
+		case RangeStrategyRandom:
+			start, _ = r.available.Select(uint32(uint64(r.random.Int63()) % card))
+		case RangeStrategyStickyHash:
+			hash := fnv.New64a()
+			hash.Write([]byte(id))
+			start, _ = r.available.Select(uint32(hash.Sum64() % card))
 		}
-		if ok := r.bitmap.CheckedAdd(candidate); ok {
+	}
+	// search from start to end and then from beginning to start
+	tail := r.free.Iterator()
+	tail.AdvanceIfNeeded(start)
+	for i, iter := range []roaring.IntPeekable{tail, r.free.Iterator()} {
+		for iter.HasNext() {
+			candidate := iter.Next()
+			if i > 0 && candidate >= start {
+				break
+			}
+			if r.accept != nil && !r.accept(candidate) {
+				r.log.Debugf(`skip not accepted value: %d`, candidate)
+				continue
+			}
+			r.free.Remove(candidate)
 			res = candidate
 			return
 		}
@@ -157,5 +440,71 @@ func (r *Range) allocateBitmap() (res uint32, err error) {
 }
 
 func (r *Range) shutdownFn() (err error) {
+	for id := range r.retries {
+		r.cancelRetry(id)
+	}
+	for _, alloc := range r.allocations {
+		if alloc.failure == nil {
+			r.release(alloc.value)
+		}
+	}
+	return
+}
+
+// recoveredRaw returns "value" from recovered values or "__values"
+func recoveredRaw(values map[string]string) (res string, ok bool) {
+	if res, ok = values["value"]; ok {
+		return
+	}
+	var raw string
+	if raw, ok = values["__values"]; !ok {
+		return
+	}
+	var parsed map[string]string
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		ok = false
+		return
+	}
+	res, ok = parsed["value"]
+	return
+}
+
+// toUint32 parses unsigned integer from int, float or string
+func toUint32(raw interface{}) (res uint32, ok bool) {
+	var parsed uint64
+	var err error
+	switch v := raw.(type) {
+	case int:
+		parsed, ok = uint64(v), v >= 0
+	case float64:
+		parsed, ok = uint64(v), v >= 0 && v == float64(uint64(v))
+	case string:
+		parsed, err = strconv.ParseUint(strings.TrimSpace(v), 10, 32)
+		ok = err == nil
+	}
+	if ok = ok && parsed <= 1<<32-1; ok {
+		res = uint32(parsed)
+	}
+	return
+}
+
+// parseValueRange parses single value or range like "100-200"
+func parseValueRange(raw string) (from, to uint32, err error) {
+	bounds := strings.SplitN(raw, "-", 2)
+	var ok bool
+	if from, ok = toUint32(bounds[0]); !ok {
+		err = fmt.Errorf(`bad value: %s`, bounds[0])
+		return
+	}
+	to = from
+	if len(bounds) == 2 {
+		if to, ok = toUint32(bounds[1]); !ok {
+			err = fmt.Errorf(`bad value: %s`, bounds[1])
+			return
+		}
+	}
+	if from > to {
+		err = fmt.Errorf(`%d is greater than %d`, from, to)
+	}
 	return
 }
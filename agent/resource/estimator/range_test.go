@@ -13,6 +13,7 @@ import (
 	"github.com/da-moon/soil/agent/resource/estimator"
 	"github.com/da-moon/soil/fixture"
 	"github.com/da-moon/soil/manifest"
+	"hash/fnv"
 	"testing"
 )
 
@@ -148,3 +149,121 @@ func TestRange(t *testing.T) {
 	}
 
 }
+
+func TestRange_Ranges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := estimator.NewRange(estimator.GlobalConfig{}, newTestConfig(ctx, "range", "range", map[string]interface{}{
+		"ranges":  []interface{}{"10-11", "20-21", 30},
+		"exclude": []interface{}{11, "20"},
+	}))
+	cons := consumeResults(ctx, r)
+	defer r.Close()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		r.Create(id, &allocation.Resource{
+			Request: manifest.Resource{Provider: "range", Name: id},
+		})
+	}
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "true",
+			"a.value":     "10",
+			"b.allocated": "true",
+			"b.value":     "21",
+			"c.allocated": "true",
+			"c.value":     "30",
+			"d.allocated": "false",
+			"d.failure":   "not-available",
+		}),
+	))
+}
+
+func TestRange_StickyHash(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := estimator.NewRange(estimator.GlobalConfig{}, newTestConfig(ctx, "range", "range", map[string]interface{}{
+		"min":      "100",
+		"max":      float64(200),
+		"strategy": "sticky-hash",
+	}))
+	cons := consumeResults(ctx, r)
+	defer r.Close()
+	// value is chosen by FNV-1a hash of id
+	hash := fnv.New64a()
+	hash.Write([]byte("a"))
+	value := fmt.Sprint(100 + hash.Sum64()%101)
+	r.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "range", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "true",
+			"a.value":     value,
+		}),
+	))
+	r.Destroy("a")
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{}),
+	))
+	r.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "range", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "true",
+			"a.value":     value,
+		}),
+	))
+}
+
+func TestRange_Random(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := estimator.NewRange(estimator.GlobalConfig{}, newTestConfig(ctx, "range", "range", map[string]interface{}{
+		"ranges":   "5-6",
+		"strategy": "random",
+	}))
+	cons := consumeResults(ctx, r)
+	defer r.Close()
+	r.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "range", Name: "a"},
+		Values:  manifest.FlatMap{"value": "5"},
+	})
+	r.Create("b", &allocation.Resource{
+		Request: manifest.Resource{Provider: "range", Name: "b"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "true",
+			"a.value":     "5",
+			"b.allocated": "true",
+			"b.value":     "6",
+		}),
+	))
+}
+
+func TestRange_BadConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := estimator.NewRange(estimator.GlobalConfig{}, newTestConfig(ctx, "range", "range", map[string]interface{}{
+		"min":      "one",
+		"ranges":   []interface{}{"20-10"},
+		"exclude":  "x",
+		"strategy": "highest",
+	}))
+	cons := consumeResults(ctx, r)
+	defer r.Close()
+	r.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "range", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "false",
+			"a.failure":   "5 errors occurred:\n\t* bad min: one\n\t* ranges can't be used with min or max\n\t* bad range: 20-10\n\t* bad exclude: x\n\t* bad strategy: highest\n\n",
+		}),
+	))
+}
@@ -0,0 +1,133 @@
+package estimator
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+
+	"github.com/da-moon/soil/manifest"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	UidEstimator = "uid" // uid estimator name
+
+	defaultUidMin    = 61184 // same as systemd DynamicUser= range
+	defaultUidMax    = 65519
+	defaultUidPrefix = "soil-"
+	defaultUidShell  = "/usr/sbin/nologin"
+)
+
+// Uid allocates user and group ids from range. Ids used by existing
+// users and groups are skipped. Optionally creates system user and
+// group with allocated id and removes them on destroy.
+type Uid struct {
+	*Range
+
+	prefix string
+	create bool
+}
+
+func NewUid(globalConfig GlobalConfig, config Config) (u *Uid) {
+	u = &Uid{
+		Range:  newRange(),
+		prefix: defaultUidPrefix,
+	}
+	u.configErr = config.nodeScopeOnly()
+	u.Range.configureRange(config.Provider.Config, defaultUidMin, defaultUidMax)
+	if configErr := u.configure(config.Provider.Config); configErr != nil {
+		u.configErr = multierror.Append(u.configErr, configErr).ErrorOrNil()
+	}
+	u.Range.accept = u.accept
+	u.Range.valuesFn = u.values
+	u.Range.releaseFn = u.release
+	u.Range.base = newBase(globalConfig, config, u.Range)
+	if u.configErr != nil {
+		u.log.Errorf(`bad config: %v`, u.configErr)
+	}
+	return
+}
+
+func (u *Uid) configure(config map[string]interface{}) (err error) {
+	err = &multierror.Error{}
+	if raw, ok := config["prefix"]; ok {
+		u.prefix = fmt.Sprint(raw)
+	}
+	if raw, ok := config["create"]; ok {
+		var parseErr error
+		if u.create, parseErr = strconv.ParseBool(fmt.Sprint(raw)); parseErr != nil {
+			err = multierror.Append(err, fmt.Errorf(`bad create: %v`, raw))
+		}
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+// accept returns true if id is not used by foreign user or group
+func (u *Uid) accept(value uint32) (ok bool) {
+	if ok = u.isFree(value); !ok {
+		u.log.Debugf(`skip used id %d`, value)
+	}
+	return
+}
+
+// values returns uid, gid and user name and creates user if configured
+func (u *Uid) values(id string, value uint32) (res manifest.FlatMap, err error) {
+	raw := strconv.FormatUint(uint64(value), 10)
+	name := u.name(value)
+	if u.create {
+		if _, lookupErr := user.LookupGroupId(raw); lookupErr != nil {
+			if err = runCommand("groupadd", "--system", "--gid", raw, name); err != nil {
+				return
+			}
+		}
+		if _, lookupErr := user.LookupId(raw); lookupErr != nil {
+			if err = runCommand("useradd", "--system", "--no-create-home", "--home-dir", "/",
+				"--shell", defaultUidShell, "--uid", raw, "--gid", raw, name); err != nil {
+				return
+			}
+		}
+	}
+	res = manifest.FlatMap{
+		"uid":   raw,
+		"gid":   raw,
+		"user":  name,
+		"group": name,
+	}
+	return
+}
+
+// release removes created user and group
+func (u *Uid) release(id string, value uint32) {
+	if !u.create {
+		return
+	}
+	name := u.name(value)
+	if err := runCommand("userdel", name); err != nil {
+		u.log.Warningf(`can't remove user %s: %v`, name, err)
+	}
+	if _, lookupErr := user.LookupGroup(name); lookupErr == nil {
+		if err := runCommand("groupdel", name); err != nil {
+			u.log.Warningf(`can't remove group %s: %v`, name, err)
+		}
+	}
+}
+
+// isFree returns true if id is not used or used by user or group
+// created for this id
+func (u *Uid) isFree(value uint32) (ok bool) {
+	raw := strconv.FormatUint(uint64(value), 10)
+	name := u.name(value)
+	if existing, err := user.LookupId(raw); err == nil && existing.Username != name {
+		return
+	}
+	if existing, err := user.LookupGroupId(raw); err == nil && existing.Name != name {
+		return
+	}
+	ok = true
+	return
+}
+
+func (u *Uid) name(value uint32) string {
+	return u.prefix + strconv.FormatUint(uint64(value), 10)
+}
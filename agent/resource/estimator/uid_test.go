@@ -0,0 +1,127 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package estimator_test
+
+import (
+	"context"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/agent/resource/estimator"
+	"github.com/da-moon/soil/fixture"
+	"github.com/da-moon/soil/manifest"
+	"testing"
+)
+
+func TestUid(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	u := estimator.NewUid(estimator.GlobalConfig{}, newTestConfig(ctx, "uid", "uid", map[string]interface{}{
+		"min":    61184,
+		"max":    "61185",
+		"prefix": "test-",
+	}))
+	cons := consumeResults(ctx, u)
+	defer u.Close()
+
+	t.Run("allocate", func(t *testing.T) {
+		u.Create("a", &allocation.Resource{
+			Request: manifest.Resource{Provider: "uid", Name: "a"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "61184",
+				"a.uid":       "61184",
+				"a.gid":       "61184",
+				"a.user":      "test-61184",
+				"a.group":     "test-61184",
+			}),
+		))
+	})
+	t.Run("recovered", func(t *testing.T) {
+		u.Create("b", &allocation.Resource{
+			Request: manifest.Resource{Provider: "uid", Name: "b"},
+			Values:  manifest.FlatMap{"value": "61185", "uid": "61185"},
+		})
+		u.Create("c", &allocation.Resource{
+			Request: manifest.Resource{Provider: "uid", Name: "c"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"a.allocated": "true",
+				"a.value":     "61184",
+				"a.uid":       "61184",
+				"a.gid":       "61184",
+				"a.user":      "test-61184",
+				"a.group":     "test-61184",
+				"b.allocated": "true",
+				"b.value":     "61185",
+				"b.uid":       "61185",
+				"b.gid":       "61185",
+				"b.user":      "test-61185",
+				"b.group":     "test-61185",
+				"c.allocated": "false",
+				"c.failure":   "not-available",
+			}),
+		))
+	})
+	t.Run("destroy reallocates", func(t *testing.T) {
+		u.Destroy("a")
+		u.Destroy("b")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"c.allocated": "true",
+				"c.value":     "61184",
+				"c.uid":       "61184",
+				"c.gid":       "61184",
+				"c.user":      "test-61184",
+				"c.group":     "test-61184",
+			}),
+		))
+	})
+}
+
+func TestUid_SkipUsed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// uid 0 is always used by root
+	u := estimator.NewUid(estimator.GlobalConfig{}, newTestConfig(ctx, "uid", "uid", map[string]interface{}{
+		"min": 0,
+		"max": 0,
+	}))
+	cons := consumeResults(ctx, u)
+	defer u.Close()
+	u.Create("a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "uid", Name: "a"},
+		Values:  manifest.FlatMap{"value": "0"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a.allocated": "false",
+			"a.failure":   "not-available",
+		}),
+	))
+}
+
+func TestUid_ClusterScope(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	u := estimator.NewUid(estimator.GlobalConfig{}, newTestConfig(ctx, "uid", "uid", map[string]interface{}{
+		"scope": "cluster",
+	}))
+	cons := consumeResults(ctx, u)
+	defer u.Close()
+	u.Create("pod.a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "uid", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"pod.a.allocated": "false",
+			"pod.a.failure":   "cluster scope is not supported by uid",
+		}),
+	))
+}
@@ -0,0 +1,360 @@
+package estimator
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/da-moon/soil/manifest"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	VolumeEstimator = "volume" // volume estimator name
+
+	VolumeRetentionRemove  = "remove"  // remove volume on destroy
+	VolumeRetentionArchive = "archive" // move volume to archive on destroy
+	VolumeRetentionKeep    = "keep"    // keep volume on destroy
+
+	VolumeQuotaNone = "none" // size is not limited
+	VolumeQuotaLoop = "loop" // size is limited by loop image
+
+	defaultVolumeMode = os.FileMode(0755)
+	volumeArchiveDir  = ".archive"
+	volumeImagesDir   = ".images"
+)
+
+type volumeAllocation struct {
+	path    string
+	size    uint64
+	failure error
+}
+
+// Volume provisions directories under configured root. Directories
+// survive updates and agent restarts and are removed, archived or kept
+// on destroy by retention policy. With "loop" quota each directory is
+// mounted from size-limited image.
+type Volume struct {
+	*base
+	configErr error
+
+	root      string
+	uid, gid  int
+	mode      os.FileMode
+	retention string
+	quota     string
+
+	allocations map[string]volumeAllocation // allocations by id
+}
+
+func NewVolume(globalConfig GlobalConfig, config Config) (v *Volume) {
+	v = &Volume{
+		uid:         -1,
+		gid:         -1,
+		mode:        defaultVolumeMode,
+		retention:   VolumeRetentionArchive,
+		quota:       VolumeQuotaNone,
+		allocations: map[string]volumeAllocation{},
+	}
+	v.configErr = v.configure(config.Provider.Config)
+	if scopeErr := config.nodeScopeOnly(); scopeErr != nil {
+		v.configErr = multierror.Append(v.configErr, scopeErr).ErrorOrNil()
+	}
+	v.base = newBase(globalConfig, config, v)
+	if v.configErr != nil {
+		v.log.Errorf(`bad config: %v`, v.configErr)
+	}
+	return
+}
+
+func (v *Volume) configure(config map[string]interface{}) (err error) {
+	err = &multierror.Error{}
+	if raw, ok := config["root"]; ok {
+		v.root = filepath.Clean(fmt.Sprint(raw))
+	}
+	if !filepath.IsAbs(v.root) {
+		err = multierror.Append(err, fmt.Errorf(`root should be absolute path: %s`, v.root))
+	}
+	if raw, ok := config["owner"]; ok {
+		var lookupErr error
+		if v.uid, lookupErr = lookupId(fmt.Sprint(raw), func(name string) (id string, err error) {
+			u, err := user.Lookup(name)
+			if err == nil {
+				id = u.Uid
+			}
+			return
+		}); lookupErr != nil {
+			err = multierror.Append(err, fmt.Errorf(`bad owner: %v`, lookupErr))
+		}
+	}
+	if raw, ok := config["group"]; ok {
+		var lookupErr error
+		if v.gid, lookupErr = lookupId(fmt.Sprint(raw), func(name string) (id string, err error) {
+			g, err := user.LookupGroup(name)
+			if err == nil {
+				id = g.Gid
+			}
+			return
+		}); lookupErr != nil {
+			err = multierror.Append(err, fmt.Errorf(`bad group: %v`, lookupErr))
+		}
+	}
+	if raw, ok := config["mode"]; ok {
+		mode, parseErr := strconv.ParseUint(fmt.Sprint(raw), 8, 32)
+		if parseErr != nil || mode > 07777 {
+			err = multierror.Append(err, fmt.Errorf(`bad mode: %v`, raw))
+		}
+		v.mode = os.FileMode(mode)
+	}
+	if raw, ok := config["retention"]; ok {
+		switch v.retention = fmt.Sprint(raw); v.retention {
+		case VolumeRetentionRemove, VolumeRetentionArchive, VolumeRetentionKeep:
+		default:
+			err = multierror.Append(err, fmt.Errorf(`bad retention: %s`, v.retention))
+		}
+	}
+	if raw, ok := config["quota"]; ok {
+		switch v.quota = fmt.Sprint(raw); v.quota {
+		case VolumeQuotaNone, VolumeQuotaLoop:
+		default:
+			err = multierror.Append(err, fmt.Errorf(`bad quota: %s`, v.quota))
+		}
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+func (v *Volume) createFn(id string, config map[string]interface{}, values map[string]string) (res interface{}, err error) {
+	if allocated, ok := v.allocations[id]; ok && allocated.failure == nil {
+		v.log.Tracef(`"%s" is already allocated: %v`, id, allocated)
+		return
+	}
+	if recovered, ok := values["path"]; ok && recovered != v.path(id) {
+		v.log.Warningf(`recovered path doesn't match: %s: %s`, id, recovered)
+	}
+	res, err = v.provision(id, config)
+	return
+}
+
+func (v *Volume) updateFn(id string, config map[string]interface{}) (res interface{}, err error) {
+	state, ok := v.allocations[id]
+	if !ok {
+		err = fmt.Errorf(`not found: %s`, id)
+		return
+	}
+	// mounted image can't be resized
+	if state.failure == nil && v.quota == VolumeQuotaLoop {
+		if size, sizeErr := volumeSize(config); sizeErr == nil {
+			if size != state.size {
+				v.log.Warningf(`size of mounted volume can't be changed: %s: %d`, id, size)
+			}
+			err = fmt.Errorf(`already allocated: %s`, id)
+			return
+		}
+	}
+	res, err = v.provision(id, config)
+	return
+}
+
+func (v *Volume) destroyFn(id string) (err error) {
+	state, ok := v.allocations[id]
+	if !ok {
+		err = fmt.Errorf(`not found: %s`, id)
+		return
+	}
+	delete(v.allocations, id)
+	if state.failure == nil {
+		if err = v.release(id); err != nil {
+			v.log.Errorf(`can't release %s: %v`, id, err)
+		}
+	}
+	v.log.Tracef(`deallocated: %s: %v`, id, state)
+	v.send(id, nil, nil)
+	return
+}
+
+func (v *Volume) shutdownFn() (err error) {
+	return
+}
+
+// provision creates volume directory or notifies about failure
+func (v *Volume) provision(id string, config map[string]interface{}) (res string, err error) {
+	alloc := volumeAllocation{
+		path: v.path(id),
+	}
+	defer func() {
+		alloc.failure = err
+		v.notify(id, alloc)
+	}()
+	if err = v.configErr; err != nil {
+		return
+	}
+	if alloc.size, err = volumeSize(config); err != nil {
+		return
+	}
+	if err = os.MkdirAll(alloc.path, v.mode); err != nil {
+		return
+	}
+	if v.quota == VolumeQuotaLoop {
+		if alloc.size == 0 {
+			err = fmt.Errorf(`size is required for loop quota`)
+			return
+		}
+		if err = v.mount(id, alloc.path, alloc.size); err != nil {
+			return
+		}
+	}
+	if err = os.Chmod(alloc.path, v.mode); err != nil {
+		return
+	}
+	if v.uid != -1 || v.gid != -1 {
+		if err = os.Chown(alloc.path, v.uid, v.gid); err != nil {
+			return
+		}
+	}
+	res = alloc.path
+	return
+}
+
+// release removes or archives volume by retention policy
+func (v *Volume) release(id string) (err error) {
+	path := v.path(id)
+	if v.retention == VolumeRetentionKeep {
+		v.log.Infof(`volume is kept: %s: %s`, id, path)
+		return
+	}
+	image := v.image(id)
+	if v.quota == VolumeQuotaLoop {
+		if err = runCommand("umount", path); err != nil {
+			return
+		}
+		if err = os.Remove(path); err != nil {
+			return
+		}
+		path = image
+	}
+	switch v.retention {
+	case VolumeRetentionArchive:
+		archive := filepath.Join(v.root, volumeArchiveDir)
+		if err = os.MkdirAll(archive, 0700); err != nil {
+			return
+		}
+		target := filepath.Join(archive, fmt.Sprintf("%s.%d", filepath.Base(path), time.Now().Unix()))
+		if err = os.Rename(path, target); err != nil {
+			return
+		}
+		v.log.Infof(`volume is archived: %s: %s`, id, target)
+	case VolumeRetentionRemove:
+		if err = os.RemoveAll(path); err != nil {
+			return
+		}
+		v.log.Infof(`volume is removed: %s: %s`, id, path)
+	}
+	return
+}
+
+// mount mounts size limited loop image to path if not mounted
+func (v *Volume) mount(id, path string, size uint64) (err error) {
+	if runCommand("mountpoint", "-q", path) == nil {
+		return
+	}
+	image := v.image(id)
+	if _, statErr := os.Stat(image); os.IsNotExist(statErr) {
+		if err = os.MkdirAll(filepath.Dir(image), 0700); err != nil {
+			return
+		}
+		var f *os.File
+		if f, err = os.OpenFile(image, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600); err != nil {
+			return
+		}
+		err = f.Truncate(int64(size))
+		f.Close()
+		if err != nil {
+			return
+		}
+		if err = runCommand("mkfs.ext4", "-q", "-F", image); err != nil {
+			os.Remove(image)
+			return
+		}
+	}
+	err = runCommand("mount", "-o", "loop", image, path)
+	return
+}
+
+func (v *Volume) notify(id string, alloc volumeAllocation) {
+	v.allocations[id] = alloc
+	var values manifest.FlatMap
+	if alloc.failure == nil {
+		values = manifest.FlatMap{
+			"path": alloc.path,
+			"size": strconv.FormatUint(alloc.size, 10),
+		}
+	}
+	v.send(id, alloc.failure, values)
+	v.log.Debugf(`downstream notified: %s:%v`, id, alloc)
+}
+
+// path returns volume path for resource
+func (v *Volume) path(id string) string {
+	return filepath.Join(v.root, volumeName(id))
+}
+
+// image returns loop image path for resource
+func (v *Volume) image(id string) string {
+	return filepath.Join(v.root, volumeImagesDir, volumeName(id)+".img")
+}
+
+// volumeName returns safe directory name for resource id. Bytes except
+// letters, digits, ".", "_" and "-" are percent-encoded as well as leading
+// dot to keep names distinct and out of reserved directories.
+func volumeName(id string) string {
+	var res strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '_' || c == '-' || c == '.' && i > 0 {
+			res.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&res, "%%%02X", c)
+	}
+	return res.String()
+}
+
+// volumeSize returns requested volume size. Zero means not limited.
+func volumeSize(config map[string]interface{}) (res uint64, err error) {
+	raw, ok := config["size"]
+	if !ok {
+		return
+	}
+	if res, err = parseCapacity(raw); err != nil {
+		err = fmt.Errorf(`size: %v`, err)
+	}
+	return
+}
+
+// lookupId parses numeric id or looks up it by name
+func lookupId(raw string, lookup func(name string) (string, error)) (res int, err error) {
+	if res, err = strconv.Atoi(raw); err == nil {
+		return
+	}
+	var id string
+	if id, err = lookup(raw); err != nil {
+		return
+	}
+	res, err = strconv.Atoi(id)
+	return
+}
+
+// runCommand runs command and returns error with its output
+func runCommand(name string, args ...string) (err error) {
+	if out, runErr := exec.Command(name, args...).CombinedOutput(); runErr != nil {
+		err = fmt.Errorf(`%s: %v: %s`, name, runErr, strings.TrimSpace(string(out)))
+	}
+	return
+}
@@ -0,0 +1,186 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package estimator_test
+
+import (
+	"context"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/agent/resource/estimator"
+	"github.com/da-moon/soil/fixture"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root, err := ioutil.TempDir("", "soil-volume")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	v := estimator.NewVolume(estimator.GlobalConfig{}, newTestConfig(ctx, "volume", "data", map[string]interface{}{
+		"root":      root,
+		"mode":      "0700",
+		"retention": "archive",
+	}))
+	cons := consumeResults(ctx, v)
+	defer v.Close()
+
+	t.Run("create", func(t *testing.T) {
+		v.Create("pod.a", &allocation.Resource{
+			Request: manifest.Resource{Provider: "data", Name: "a"},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"pod.a.allocated": "true",
+				"pod.a.path":      filepath.Join(root, "pod.a"),
+				"pod.a.size":      "0",
+			}),
+		))
+		info, err := os.Stat(filepath.Join(root, "pod.a"))
+		require.NoError(t, err)
+		assert.True(t, info.IsDir())
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	})
+	t.Run("update keeps data", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, "pod.a", "data"), []byte("1"), 0600))
+		v.Update("pod.a", &allocation.Resource{
+			Request: manifest.Resource{Provider: "data", Name: "a", Config: map[string]interface{}{"size": "1M"}},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"pod.a.allocated": "true",
+				"pod.a.path":      filepath.Join(root, "pod.a"),
+				"pod.a.size":      "1048576",
+			}),
+		))
+		_, err := os.Stat(filepath.Join(root, "pod.a", "data"))
+		assert.NoError(t, err)
+	})
+	t.Run("bad size", func(t *testing.T) {
+		v.Create("pod.b", &allocation.Resource{
+			Request: manifest.Resource{Provider: "data", Name: "b", Config: map[string]interface{}{"size": "1X"}},
+		})
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{
+				"pod.a.allocated": "true",
+				"pod.a.path":      filepath.Join(root, "pod.a"),
+				"pod.a.size":      "1048576",
+				"pod.b.allocated": "false",
+				"pod.b.failure":   "size: bad value: 1X",
+			}),
+		))
+	})
+	t.Run("destroy archives", func(t *testing.T) {
+		v.Destroy("pod.a")
+		v.Destroy("pod.b")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+			bus.NewMessage("test", map[string]string{}),
+		))
+		_, err := os.Stat(filepath.Join(root, "pod.a"))
+		assert.True(t, os.IsNotExist(err))
+		archived, err := filepath.Glob(filepath.Join(root, ".archive", "pod.a.*", "data"))
+		assert.NoError(t, err)
+		assert.Len(t, archived, 1)
+	})
+}
+
+func TestVolume_Remove(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root, err := ioutil.TempDir("", "soil-volume")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	v := estimator.NewVolume(estimator.GlobalConfig{}, newTestConfig(ctx, "volume", "data", map[string]interface{}{
+		"root":      root,
+		"retention": "remove",
+	}))
+	cons := consumeResults(ctx, v)
+	defer v.Close()
+
+	v.Create("pod.a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "data", Name: "a"},
+		Values:  manifest.FlatMap{"path": filepath.Join(root, "pod.a")},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"pod.a.allocated": "true",
+			"pod.a.path":      filepath.Join(root, "pod.a"),
+			"pod.a.size":      "0",
+		}),
+	))
+	v.Destroy("pod.a")
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{}),
+	))
+	_, err = os.Stat(filepath.Join(root, "pod.a"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestVolume_Names(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root, err := ioutil.TempDir("", "soil-volume")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	v := estimator.NewVolume(estimator.GlobalConfig{}, newTestConfig(ctx, "volume", "data", map[string]interface{}{
+		"root": root,
+	}))
+	cons := consumeResults(ctx, v)
+	defer v.Close()
+
+	for _, id := range []string{"a/b", "a_b", "..", ".archive"} {
+		v.Create(id, &allocation.Resource{
+			Request: manifest.Resource{Provider: "data", Name: id},
+		})
+	}
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"a/b.allocated":      "true",
+			"a/b.path":           filepath.Join(root, "a%2Fb"),
+			"a/b.size":           "0",
+			"a_b.allocated":      "true",
+			"a_b.path":           filepath.Join(root, "a_b"),
+			"a_b.size":           "0",
+			"...allocated":       "true",
+			"...path":            filepath.Join(root, "%2E."),
+			"...size":            "0",
+			".archive.allocated": "true",
+			".archive.path":      filepath.Join(root, "%2Earchive"),
+			".archive.size":      "0",
+		}),
+	))
+}
+
+func TestVolume_BadConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	v := estimator.NewVolume(estimator.GlobalConfig{}, newTestConfig(ctx, "volume", "data", map[string]interface{}{
+		"root":      "data",
+		"retention": "forever",
+	}))
+	cons := consumeResults(ctx, v)
+	defer v.Close()
+	v.Create("pod.a", &allocation.Resource{
+		Request: manifest.Resource{Provider: "data", Name: "a"},
+	})
+	fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(
+		bus.NewMessage("test", map[string]string{
+			"pod.a.allocated": "false",
+			"pod.a.failure":   "2 errors occurred:\n\t* root should be absolute path: data\n\t* bad retention: forever\n\n",
+		}),
+	))
+}
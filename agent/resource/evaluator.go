@@ -10,7 +10,11 @@ import (
 	"github.com/da-moon/soil/agent/bus/pipe"
 	"github.com/da-moon/soil/agent/resource/estimator"
 	"github.com/da-moon/soil/manifest"
+	"github.com/da-moon/soil/proto"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 )
 
 const (
@@ -31,6 +35,9 @@ type Evaluator struct {
 	upstream   bus.Consumer // upstream bus consumer
 	downstream bus.Consumer // downstream consumer
 
+	globalConfig estimator.GlobalConfig
+
+	mu          sync.RWMutex                        // guards allocations and sandboxes for inventory
 	allocations map[string]allocation.ResourceSlice // allocations by pod
 	sandboxes   map[string]*Sandbox
 
@@ -61,6 +68,12 @@ func NewEvaluator(ctx context.Context, log *logx.Log, upstream, downstream bus.C
 	return
 }
 
+// SetGlobalConfig sets config for all estimators. SetGlobalConfig should be
+// called before Open.
+func (e *Evaluator) SetGlobalConfig(config estimator.GlobalConfig) {
+	e.globalConfig = config
+}
+
 func (e *Evaluator) Open() (err error) {
 	go e.loop()
 	// reset upstream and downstream
@@ -92,12 +105,14 @@ func (e *Evaluator) Open() (err error) {
 	e.log.Debugf(`dirty state sent to upstream: %v`, upstream)
 
 	// initialise dirty sandboxes
+	e.mu.Lock()
 	for providerId := range e.sandboxes {
 		e.sandboxes[providerId] = e.createSandbox(providerId, &allocation.Provider{
 			Name: providerId,
 			Kind: estimator.BlackholeEstimator,
 		})
 	}
+	e.mu.Unlock()
 
 	err = e.Control.Open()
 	return
@@ -185,6 +200,71 @@ func (e *Evaluator) DestroyProvider(id string) {
 	}
 }
 
+// Providers returns all providers with utilisation
+func (e *Evaluator) Providers() (res proto.ProvidersInfo) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	res = proto.ProvidersInfo{}
+	for _, sandbox := range e.sandboxes {
+		if sandbox == nil {
+			continue
+		}
+		provider, _ := sandbox.Info()
+		res = append(res, provider)
+	}
+	sort.Sort(res)
+	return
+}
+
+// Resources returns all resource requests with allocation states
+func (e *Evaluator) Resources() (res proto.ResourcesInfo) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	states := map[string]*allocation.Resource{}
+	for _, sandbox := range e.sandboxes {
+		if sandbox == nil {
+			continue
+		}
+		_, resources := sandbox.Info()
+		for id, resource := range resources {
+			states[id] = resource
+		}
+	}
+	res = proto.ResourcesInfo{}
+	for pod, resources := range e.allocations {
+		for _, resource := range resources {
+			info := proto.ResourceInfo{
+				ID:       pod + "." + resource.Request.Name,
+				Pod:      pod,
+				Name:     resource.Request.Name,
+				Provider: resource.Request.Provider,
+				Config:   resource.Request.Config,
+			}
+			values := resource.Values
+			if state, ok := states[info.ID]; ok && state.Request.Provider == info.Provider {
+				values = state.Values
+			}
+			for k, v := range values {
+				switch {
+				case k == "allocated":
+					info.Allocated = v == "true"
+				case k == "failure":
+					info.Failure = v
+				case k == "provider" || strings.HasPrefix(k, "__"):
+				default:
+					if info.Values == nil {
+						info.Values = map[string]string{}
+					}
+					info.Values[k] = v
+				}
+			}
+			res = append(res, info)
+		}
+	}
+	sort.Sort(res)
+	return
+}
+
 func (e *Evaluator) loop() {
 LOOP:
 	for {
@@ -206,13 +286,18 @@ LOOP:
 				if op.op == opProviderUpdate {
 					e.log.Warningf(`update provider "%s": not found`, op.id)
 				}
-				e.sandboxes[op.id] = e.createSandbox(op.id, op.provider)
+				sandbox := e.createSandbox(op.id, op.provider)
+				e.mu.Lock()
+				e.sandboxes[op.id] = sandbox
+				e.mu.Unlock()
 			case opProviderDestroy:
 				if sandbox, ok := e.sandboxes[op.id]; ok {
 					if err := sandbox.Shutdown(); err != nil {
 						e.log.Error(err)
 					}
+					e.mu.Lock()
 					delete(e.sandboxes, op.id)
+					e.mu.Unlock()
 					e.log.Debugf(`destroyed sandbox %s`, op.id)
 					continue LOOP
 				}
@@ -223,7 +308,9 @@ LOOP:
 			left := e.allocations[pod]
 			c, u, d := Plan(left, alloc.Resources)
 			e.log.Debugf(`pod "%s" planned: create:%v update:%v destroy:%v`, pod, c, u, d)
+			e.mu.Lock()
 			e.allocations[pod] = alloc.Resources
+			e.mu.Unlock()
 			for _, req := range c {
 				id := pod + "." + req.Request.Name
 				if sandbox, ok := e.sandboxes[req.Request.Provider]; ok {
@@ -252,7 +339,9 @@ LOOP:
 					}
 					e.log.Warningf(`destroy "%s": provider "%s" not found`, id, resource.Request.Provider)
 				}
+				e.mu.Lock()
 				delete(e.allocations, podName)
+				e.mu.Unlock()
 				e.log.Infof(`deallocated "%s"`, podName)
 				continue LOOP
 			}
@@ -264,7 +353,7 @@ LOOP:
 func (e *Evaluator) createSandbox(id string, alloc *allocation.Provider) (s *Sandbox) {
 	s = NewSandbox(
 		SandboxConfig{
-			GlobalConfig: estimator.GlobalConfig{},
+			GlobalConfig: e.globalConfig,
 			Ctx:          e.Control.Ctx(),
 			Log:          e.log,
 			Upstream:     e.upstream,
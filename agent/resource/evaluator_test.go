@@ -12,7 +12,9 @@ import (
 	"github.com/da-moon/soil/agent/resource"
 	"github.com/da-moon/soil/fixture"
 	"github.com/da-moon/soil/manifest"
+	"github.com/da-moon/soil/proto"
 	"github.com/stretchr/testify/assert"
+	"reflect"
 	"testing"
 )
 
@@ -270,3 +272,70 @@ func TestNewEvaluator(t *testing.T) {
 	}
 
 }
+
+func TestEvaluator_Inventory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	upstream := bus.NewTestingConsumer(ctx)
+	downstream := bus.NewTestingConsumer(ctx)
+	evaluator := resource.NewEvaluator(ctx, logx.GetLog("test"), upstream, downstream, nil)
+	assert.NoError(t, evaluator.Open())
+
+	evaluator.CreateProvider("pod.port", &allocation.Provider{
+		Name: "port",
+		Kind: "range",
+		Config: map[string]interface{}{
+			"min": 8000,
+			"max": 8001,
+		},
+	})
+	evaluator.Allocate(&manifest.Pod{
+		Name: "pod",
+		Resources: manifest.Resources{
+			{Name: "a", Provider: "pod.port"},
+			{Name: "b", Provider: "pod.port"},
+			{Name: "c", Provider: "pod.port"},
+		},
+	}, map[string]string{})
+
+	t.Run(`providers`, func(t *testing.T) {
+		fixture.WaitNoErrorT10(t, func() (err error) {
+			expect := proto.ProvidersInfo{
+				{
+					ID:   "pod.port",
+					Pod:  "pod",
+					Name: "port",
+					Kind: "range",
+					Config: map[string]interface{}{
+						"min": 8000,
+						"max": 8001,
+					},
+					Used:   2,
+					Failed: 1,
+					Total:  2,
+				},
+			}
+			if res := evaluator.Providers(); !reflect.DeepEqual(expect, res) {
+				err = fmt.Errorf(`not equal: %v != %v`, expect, res)
+			}
+			return
+		})
+	})
+	t.Run(`resources`, func(t *testing.T) {
+		res := evaluator.Resources()
+		assert.Len(t, res, 3)
+		var values []string
+		for i, name := range []string{"a", "b", "c"} {
+			assert.Equal(t, "pod."+name, res[i].ID)
+			assert.Equal(t, "pod", res[i].Pod)
+			assert.Equal(t, "pod.port", res[i].Provider)
+			if res[i].Allocated {
+				values = append(values, res[i].Values["value"])
+				continue
+			}
+			assert.Equal(t, "not-available", res[i].Failure)
+		}
+		assert.ElementsMatch(t, []string{"8000", "8001"}, values)
+	})
+}
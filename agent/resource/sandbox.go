@@ -2,12 +2,15 @@ package resource
 
 import (
 	"context"
+	"strings"
+	"sync"
 
 	"github.com/akaspin/logx"
 	"github.com/da-moon/soil/agent/allocation"
 	"github.com/da-moon/soil/agent/bus"
 	"github.com/da-moon/soil/agent/resource/estimator"
 	"github.com/da-moon/soil/manifest"
+	"github.com/da-moon/soil/proto"
 )
 
 const (
@@ -38,6 +41,8 @@ type Sandbox struct {
 	config     SandboxConfig
 	id         string
 
+	mu            sync.RWMutex // guards provider, estimator and resources for Info
+	provider      *allocation.Provider
 	estimatorUuid string
 	estimator     Estimator
 	resources     map[string]*allocation.Resource //
@@ -142,6 +147,38 @@ func (s *Sandbox) Close() (err error) {
 	return
 }
 
+// Info returns provider info and states of resources
+func (s *Sandbox) Info() (provider proto.ProviderInfo, resources map[string]*allocation.Resource) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	provider = proto.ProviderInfo{
+		ID:     s.id,
+		Name:   s.provider.Name,
+		Kind:   s.provider.Kind,
+		Config: s.provider.Config,
+	}
+	// dirty providers are named by full id
+	if provider.Pod = strings.TrimSuffix(s.id, "."+provider.Name); provider.Pod == s.id {
+		if i := strings.LastIndex(s.id, "."); i != -1 {
+			provider.Pod, provider.Name = s.id[:i], s.id[i+1:]
+		}
+	}
+	if bounded, ok := s.estimator.(Bounded); ok {
+		provider.Total = bounded.Total()
+	}
+	resources = make(map[string]*allocation.Resource, len(s.resources))
+	for id, resource := range s.resources {
+		resources[id] = resource.Clone()
+		switch resource.Values["allocated"] {
+		case "true":
+			provider.Used++
+		case "false":
+			provider.Failed++
+		}
+	}
+	return
+}
+
 func (s *Sandbox) loop() {
 	var err error
 LOOP:
@@ -167,7 +204,9 @@ LOOP:
 			s.log.Tracef(`received result %s`, res.Message)
 			if res.Message.Payload().IsEmpty() {
 				// empty: delete internal
+				s.mu.Lock()
 				delete(s.resources, res.Message.Topic())
+				s.mu.Unlock()
 				s.config.Downstream.ConsumeMessage(res.Message)
 				s.log.Infof(`destroyed: %s`, res.Message.Topic())
 				continue LOOP
@@ -178,7 +217,9 @@ LOOP:
 					s.log.Warning(err)
 					continue LOOP
 				}
+				s.mu.Lock()
 				state.Values = payload
+				s.mu.Unlock()
 				s.config.Downstream.ConsumeMessage(bus.NewMessage(res.Message.Topic(), payload.Merge(manifest.FlatMap{
 					"provider": s.id,
 				})))
@@ -198,7 +239,9 @@ LOOP:
 					s.log.Debugf(`create: resource already exists: %v`, op)
 					continue LOOP
 				}
+				s.mu.Lock()
 				s.resources[op.id] = op.resource
+				s.mu.Unlock()
 				if err = s.estimator.Create(op.id, op.resource); err != nil {
 					s.log.Error(err)
 				}
@@ -207,7 +250,9 @@ LOOP:
 					s.log.Debugf(`update: resource not found: %v`, op)
 					continue LOOP
 				}
+				s.mu.Lock()
 				s.resources[op.id] = op.resource
+				s.mu.Unlock()
 				if err = s.estimator.Update(op.id, op.resource); err != nil {
 					s.log.Error(err)
 				}
@@ -216,7 +261,9 @@ LOOP:
 					s.log.Debugf(`destroy: resource not found: %s`, op.id)
 					continue LOOP
 				}
+				s.mu.Lock()
 				delete(s.resources, op.id)
+				s.mu.Unlock()
 				if s.estimator.Destroy(op.id); err != nil {
 					s.log.Error(err)
 				}
@@ -227,8 +274,7 @@ LOOP:
 }
 
 func (s *Sandbox) reconfigure(p *allocation.Provider) {
-	var err error
-	s.estimator, err = GetEstimator(s.config.GlobalConfig, estimator.Config{
+	e, err := GetEstimator(s.config.GlobalConfig, estimator.Config{
 		Ctx:      s.ctx,
 		Log:      s.log.GetLog("resource", "estimator", p.Kind, s.id),
 		Provider: p,
@@ -237,6 +283,10 @@ func (s *Sandbox) reconfigure(p *allocation.Provider) {
 	if err != nil {
 		s.log.Error(err)
 	}
+	s.mu.Lock()
+	s.provider = p
+	s.estimator = e
+	s.mu.Unlock()
 	var ch chan *estimator.Result
 	var ctx context.Context
 	s.estimatorUuid, ctx, ch = s.estimator.Results()
@@ -3,11 +3,14 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sync"
 
 	"github.com/akaspin/logx"
 	"github.com/akaspin/supervisor"
 	"github.com/da-moon/soil/agent/allocation"
 	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/lib"
 	"github.com/da-moon/soil/manifest"
 )
 
@@ -17,6 +20,10 @@ type Sink struct {
 	boundedEvaluators []BoundedEvaluator
 
 	state *SinkState
+
+	mu         sync.Mutex
+	meta       map[string]string            // agent meta or <nil> if not received yet
+	registries map[string]manifest.PodSlice // registries by namespace before expansion
 }
 
 func (s *Sink) ConsumeMessage(message bus.Message) (err error) {
@@ -33,6 +40,7 @@ func NewSink(ctx context.Context, log *logx.Log, state allocation.PodSlice, boun
 		Control:           supervisor.NewControl(ctx),
 		log:               log.GetLog("scheduler", "sink"),
 		boundedEvaluators: boundedEvaluators,
+		registries:        map[string]manifest.PodSlice{},
 	}
 	dirty := map[string]string{}
 	for _, recovered := range state {
@@ -43,26 +51,72 @@ func NewSink(ctx context.Context, log *logx.Log, state allocation.PodSlice, boun
 }
 
 func (s *Sink) ConsumeRegistry(registry manifest.PodSlice) {
-	byNamespace := map[string]manifest.PodSlice{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ns, r := range splitByNamespace(registry) {
+		s.registries[ns] = r
+		s.syncNamespace(ns, r)
+	}
+}
+
+func splitByNamespace(registry manifest.PodSlice) (res map[string]manifest.PodSlice) {
+	res = map[string]manifest.PodSlice{}
 	for _, pod := range registry {
-		byNamespace[pod.Namespace] = append(byNamespace[pod.Namespace], pod)
+		res[pod.Namespace] = append(res[pod.Namespace], pod)
+	}
+	return
+}
+
+// ConsumeConfig accepts agent meta with registry from agent config and
+// syncs all registries once. Pods with "for_each" are expanded with new
+// meta and blob source files are re-read. Only changed pods are
+// resubmitted.
+func (s *Sink) ConsumeConfig(meta map[string]string, registry manifest.PodSlice) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.meta == nil || !reflect.DeepEqual(s.meta, meta) {
+		s.meta = lib.CloneMap(meta)
+		s.log.Debugf("meta changed: %v", s.meta)
 	}
+	for ns, r := range splitByNamespace(registry) {
+		s.registries[ns] = r
+	}
+	for ns, r := range s.registries {
+		s.syncNamespace(ns, r)
+	}
+}
 
-	for ns, r := range byNamespace {
-		s.log.Debugf("submitting: %s", ns)
-		changes := s.state.SyncNamespace(ns, r)
-		var report []string
-		for name, pod := range changes {
-			s.submitToEvaluators(name, pod)
-			if pod != nil {
-				report = append(report, fmt.Sprintf(`%s(ns:%s,mark:%d)`, name, pod.Namespace, pod.Mark()))
-				continue
+func (s *Sink) syncNamespace(ns string, raw manifest.PodSlice) {
+	if s.meta == nil {
+		for _, pod := range raw {
+			if pod.ForEach != "" {
+				s.log.Debugf("postpone %s: meta is not received", ns)
+				return
 			}
-			report = append(report, fmt.Sprintf(`%s(nil)`, name))
 		}
-		s.log.Infof("submitted changes: %v", report)
 	}
+	env := map[string]string{}
+	for k, v := range s.meta {
+		env["meta."+k] = v
+	}
+	r, err := raw.Expand(env)
+	if err != nil {
+		s.log.Errorf("expand %s: %v", ns, err)
+	}
+	r = r.MarkSourceFiles()
 
+	s.log.Debugf("submitting: %s", ns)
+	changes := s.state.SyncNamespace(ns, r)
+	var report []string
+	for name, pod := range changes {
+		s.submitToEvaluators(name, pod)
+		if pod != nil {
+			report = append(report, fmt.Sprintf(`%s(ns:%s,mark:%d)`, name, pod.Namespace, pod.Mark()))
+			continue
+		}
+		report = append(report, fmt.Sprintf(`%s(nil)`, name))
+	}
+	s.log.Infof("submitted changes: %v", report)
 }
 
 func (s *Sink) submitToEvaluators(id string, pod *manifest.Pod) {
@@ -17,6 +17,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -188,3 +189,56 @@ func TestSink_ConsumeRegistry(t *testing.T) {
 	}
 
 }
+
+func TestSink_ConsumeConfig(t *testing.T) {
+	ctx := context.Background()
+	log := logx.GetLog("test")
+
+	arbiter1 := scheduler.NewArbiter(ctx, log, "a1", scheduler.ArbiterConfig{})
+	evaluator1 := &dummyEv{}
+	sink := scheduler.NewSink(ctx, log, nil, scheduler.NewBoundedEvaluator(arbiter1, evaluator1))
+	sv := supervisor.NewChain(ctx, arbiter1, sink)
+	assert.NoError(t, sv.Open())
+	defer sv.Wait()
+	defer sv.Close()
+	arbiter1.ConsumeMessage(bus.NewMessage("", map[string]string{}))
+
+	consume := func(meta map[string]string, src string) {
+		var registry manifest.PodSlice
+		assert.NoError(t, registry.Unmarshal(manifest.PrivateNamespace, strings.NewReader(src)))
+		sink.ConsumeConfig(meta, registry)
+	}
+	consume(map[string]string{"workers": "a"}, `
+pod "worker-${each}" {
+  for_each = "${meta.workers}"
+}
+`)
+	fixture.WaitNoErrorT10(t, func() (err error) {
+		evaluator1.mu.Lock()
+		defer evaluator1.mu.Unlock()
+		if len(evaluator1.records["worker-a"]) != 1 {
+			err = fmt.Errorf("not allocated: %v", evaluator1.records)
+		}
+		return
+	})
+
+	// meta and registry change together: pod should not be destroyed
+	consume(map[string]string{}, `
+pod "worker-a" {}
+pod "marker" {}
+`)
+	fixture.WaitNoErrorT10(t, func() (err error) {
+		evaluator1.mu.Lock()
+		defer evaluator1.mu.Unlock()
+		if len(evaluator1.records["marker"]) != 1 {
+			err = fmt.Errorf("not synced: %v", evaluator1.records)
+			return
+		}
+		for _, record := range evaluator1.records["worker-a"] {
+			if !record.alloc {
+				err = fmt.Errorf("deallocated: %v", evaluator1.records)
+			}
+		}
+		return
+	})
+}
@@ -13,11 +13,14 @@ import (
 	"github.com/da-moon/soil/agent/provider"
 	"github.com/da-moon/soil/agent/provision"
 	"github.com/da-moon/soil/agent/resource"
+	"github.com/da-moon/soil/agent/resource/estimator"
 	"github.com/da-moon/soil/agent/scheduler"
 	"github.com/da-moon/soil/lib"
 	"github.com/da-moon/soil/manifest"
 	"github.com/da-moon/soil/proto"
 	"regexp"
+	"sync"
+	"time"
 )
 
 var ServerVersion string
@@ -26,6 +29,7 @@ type ServerOptions struct {
 	AgentId    string
 	ConfigPath []string
 	Address    string
+	StateDir   string // Directory to store allocations. Allocations are recovered from pod units if empty
 	Meta       map[string]string
 }
 
@@ -39,12 +43,16 @@ type Server struct {
 
 	confPipe  bus.Consumer
 	sink      *scheduler.Sink
+	provision *provision.Evaluator
 	kv        *cluster.KV
 	api       *api_server.Router
 	endpoints struct {
 		registryGet    *api_server.Endpoint
 		statusNodesGet *api_server.Endpoint
 	}
+
+	drainMu sync.Mutex
+	drain   bool
 }
 
 func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Server) {
@@ -58,10 +66,11 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 	// Recovery
 
 	systemPaths := allocation.DefaultSystemPaths()
-	var state allocation.PodSlice
-	if recoveryErr := state.FromFilesystem(systemPaths, allocation.DefaultDbusDiscoveryFunc); recoveryErr != nil {
-		s.log.Errorf("recovered with failure: %v", recoveryErr)
+	var store *allocation.Store
+	if options.StateDir != "" {
+		store = allocation.NewStore(options.StateDir, systemPaths)
 	}
+	state := s.recover(store, systemPaths)
 
 	// provision
 
@@ -83,10 +92,11 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 	provisionStateConsumer := pipe.NewLift("provision", pipe.NewTee(
 		provisionStrictPipe,
 	))
-	provisionEvaluator := provision.NewEvaluator(ctx, s.log, provision.EvaluatorConfig{
+	s.provision = provision.NewEvaluator(ctx, s.log, provision.EvaluatorConfig{
 		SystemPaths:    systemPaths,
 		Recovery:       state,
 		StatusConsumer: provisionStateConsumer,
+		Store:          store,
 	})
 
 	// Resource
@@ -105,6 +115,10 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 		resourceStrictPipe,
 		provisionStrictPipe,
 		state)
+	resourceEvaluator.SetGlobalConfig(estimator.GlobalConfig{
+		Claimer: s.kv,
+		Pods:    s.provision,
+	})
 
 	// Provider evaluator
 
@@ -132,6 +146,9 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 	)
 
 	drainFn := func(on bool) {
+		s.drainMu.Lock()
+		s.drain = on
+		s.drainMu.Unlock()
 		providerDrainPipe.Divert(on)
 		resourceDrainPipe.Divert(on)
 		provisionDrainPipe.Divert(on)
@@ -143,11 +160,17 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 	s.api = api_server.NewRouter(s.log,
 		// status
 		api.NewStatusPingGet(),
+		api.NewStatusNodeGet(s.status),
 
 		// agent
 		api.NewAgentReloadPut(s.Configure),
 		api.NewAgentDrainPut(drainFn),
 		api.NewAgentDrainDelete(drainFn),
+		api.NewAgentDriftGet(s.provision.Drift),
+
+		// resources
+		api.NewProvidersGet(resourceEvaluator.Providers),
+		api.NewResourcesGet(resourceEvaluator.Resources),
 
 		// cluster
 		s.endpoints.statusNodesGet,
@@ -161,7 +184,7 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 	s.sink = scheduler.NewSink(ctx, s.log, state,
 		scheduler.NewBoundedEvaluator(providerArbiter, providerEvaluator),
 		scheduler.NewBoundedEvaluator(resourceArbiter, resourceEvaluator),
-		scheduler.NewBoundedEvaluator(provisionArbiter, provisionEvaluator),
+		scheduler.NewBoundedEvaluator(provisionArbiter, s.provision),
 	)
 
 	s.sv = supervisor.NewChain(ctx,
@@ -173,13 +196,54 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 		supervisor.NewGroup(ctx,
 			providerEvaluator,
 			resourceEvaluator,
-			provisionEvaluator),
+			s.provision),
 		s.sink,
 		api_server.NewServer(ctx, s.log, s.options.Address, s.api),
 	)
 	return
 }
 
+// status returns agent status
+func (s *Server) status() (res proto.NodeStatus) {
+	s.drainMu.Lock()
+	drain := s.drain
+	s.drainMu.Unlock()
+	res = proto.NodeStatus{
+		ID:      s.options.AgentId,
+		Version: proto.Version,
+		API:     proto.APIV1Version,
+		Drain:   drain,
+		Drift:   s.provision.Drift(),
+	}
+	return
+}
+
+// recover returns allocations from store. Allocations are recovered from pod
+// unit specs and imported to store if store is not initialized.
+func (s *Server) recover(store *allocation.Store, systemPaths allocation.SystemPaths) (state allocation.PodSlice) {
+	if store != nil && store.IsInitialized() {
+		var recoveryErr error
+		if state, recoveryErr = store.Load(); recoveryErr != nil {
+			s.log.Errorf("recovered from store with failure: %v", recoveryErr)
+		}
+		return
+	}
+	if recoveryErr := state.FromFilesystem(systemPaths, allocation.DefaultDbusDiscoveryFunc); recoveryErr != nil {
+		s.log.Errorf("recovered with failure: %v", recoveryErr)
+	}
+	if recoveryErr := state.FromTransient(systemPaths, allocation.DefaultTransientDiscoveryFunc); recoveryErr != nil {
+		s.log.Errorf("recovered transient pods with failure: %v", recoveryErr)
+	}
+	if store != nil {
+		if migrateErr := store.Migrate(state); migrateErr != nil {
+			s.log.Errorf("migrate to store: %v", migrateErr)
+			return
+		}
+		s.log.Infof("migrated %d pods to store %s", len(state), store.Dir)
+	}
+	return
+}
+
 func (s *Server) Open() (err error) {
 	if err = s.sv.Open(); err != nil {
 		return
@@ -239,9 +303,34 @@ func (s *Server) Configure() {
 		API:       proto.APIV1Version,
 	}))
 
+	var secretKey *manifest.SecretKey
+	if serverCfg.SecretKey != "" {
+		var err error
+		if secretKey, err = manifest.ParseSecretKey(serverCfg.SecretKey); err != nil {
+			s.log.Errorf("parse secret key: %v", err)
+		}
+	}
+	s.provision.SetSecretKey(secretKey)
+	driftConfig := provision.DriftConfig{
+		Policy: serverCfg.Drift.Policy,
+	}
+	if serverCfg.Drift.Interval != "" {
+		var err error
+		if driftConfig.Interval, err = time.ParseDuration(serverCfg.Drift.Interval); err != nil {
+			s.log.Errorf("parse drift interval: %v", err)
+		}
+	}
+	switch driftConfig.Policy {
+	case "", provision.DriftPolicyReport, provision.DriftPolicyRepair:
+	default:
+		s.log.Errorf("unknown drift policy %s: using %s", driftConfig.Policy, provision.DriftPolicyReport)
+		driftConfig.Policy = provision.DriftPolicyReport
+	}
+	s.provision.SetDriftConfig(driftConfig)
+
 	s.confPipe.ConsumeMessage(bus.NewMessage("meta", serverCfg.Meta))
 	s.confPipe.ConsumeMessage(bus.NewMessage("system", serverCfg.System))
 
-	s.sink.ConsumeRegistry(registry)
+	s.sink.ConsumeConfig(serverCfg.Meta, registry)
 	s.log.Debug("configure: done")
 }
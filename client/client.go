@@ -0,0 +1,246 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/da-moon/soil/agent/api/api-server"
+	"github.com/da-moon/soil/manifest"
+	"github.com/da-moon/soil/proto"
+)
+
+const (
+	defaultScheme = "http"
+	maxRedirects  = 10
+
+	queryParamNode     = "node"
+	queryParamRedirect = "redirect"
+)
+
+// Client is Soil Agent API client. Requests are routed to node given by
+// WithNode option. Requests to other nodes are proxied by Agent unless
+// WithRedirect is given.
+type Client struct {
+	address    *url.URL
+	httpClient *http.Client
+	node       string
+	redirect   bool
+}
+
+// Option configures Client
+type Option func(c *Client)
+
+// WithNode routes requests to node with given ID. Empty ID or "self" means
+// node which accepts request.
+func WithNode(id string) Option {
+	return func(c *Client) {
+		c.node = id
+	}
+}
+
+// WithRedirect asks Agent to redirect requests to other nodes instead of
+// proxying them.
+func WithRedirect() Option {
+	return func(c *Client) {
+		c.redirect = true
+	}
+}
+
+// WithHTTPClient sets underlying HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient returns client for Agent on given address. Address may be
+// given as "host:port" or URL.
+func NewClient(address string, opts ...Option) (c *Client, err error) {
+	if !strings.Contains(address, "://") {
+		address = defaultScheme + "://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return
+	}
+	if u.Host == "" {
+		err = fmt.Errorf(`bad address: %s`, address)
+		return
+	}
+	c = &Client{
+		address:    u,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return
+}
+
+// WithOptions returns copy of client with given options applied
+func (c *Client) WithOptions(opts ...Option) (res *Client) {
+	copied := *c
+	res = &copied
+	for _, opt := range opts {
+		opt(res)
+	}
+	return
+}
+
+// Ping checks Agent availability
+func (c *Client) Ping(ctx context.Context) (err error) {
+	err = c.do(ctx, http.MethodGet, proto.V1StatusPing, nil, nil)
+	return
+}
+
+// Nodes returns cluster nodes
+func (c *Client) Nodes(ctx context.Context) (res proto.NodesInfo, err error) {
+	err = c.do(ctx, http.MethodGet, proto.V1StatusNodes, nil, &res)
+	return
+}
+
+// Status returns status of node
+func (c *Client) Status(ctx context.Context) (res proto.NodeStatus, err error) {
+	err = c.do(ctx, http.MethodGet, proto.V1StatusNode, nil, &res)
+	return
+}
+
+// Drift returns drifted paths by pod
+func (c *Client) Drift(ctx context.Context) (res map[string][]string, err error) {
+	err = c.do(ctx, http.MethodGet, proto.V1AgentDrift, nil, &res)
+	return
+}
+
+// Providers returns resource providers on agent
+func (c *Client) Providers(ctx context.Context) (res proto.ProvidersInfo, err error) {
+	err = c.do(ctx, http.MethodGet, proto.V1Providers, nil, &res)
+	return
+}
+
+// Resources returns resources with allocation states on agent
+func (c *Client) Resources(ctx context.Context) (res proto.ResourcesInfo, err error) {
+	err = c.do(ctx, http.MethodGet, proto.V1Resources, nil, &res)
+	return
+}
+
+// RegistryGet returns pods in cluster registry
+func (c *Client) RegistryGet(ctx context.Context) (res manifest.PodSlice, err error) {
+	err = c.do(ctx, http.MethodGet, proto.V1Registry, nil, &res)
+	return
+}
+
+// RegistryPut puts pods to cluster registry
+func (c *Client) RegistryPut(ctx context.Context, pods manifest.PodSlice) (err error) {
+	err = c.do(ctx, http.MethodPut, proto.V1Registry, pods, nil)
+	return
+}
+
+// RegistryDelete removes pods with given names from cluster registry
+func (c *Client) RegistryDelete(ctx context.Context, names ...string) (err error) {
+	err = c.do(ctx, http.MethodDelete, proto.V1Registry, names, nil)
+	return
+}
+
+// Drain turns drain mode on or off
+func (c *Client) Drain(ctx context.Context, on bool) (err error) {
+	method := http.MethodDelete
+	if on {
+		method = http.MethodPut
+	}
+	err = c.do(ctx, method, proto.V1AgentDrain, nil, nil)
+	return
+}
+
+// Reload asks Agent to reload configuration
+func (c *Client) Reload(ctx context.Context) (err error) {
+	err = c.do(ctx, http.MethodPut, proto.V1AgentReload, nil, nil)
+	return
+}
+
+// URL returns request URL for given path with routing parameters
+func (c *Client) URL(path string) (res *url.URL) {
+	res = c.address.ResolveReference(&url.URL{Path: path})
+	values := url.Values{}
+	if c.node != "" {
+		values.Set(queryParamNode, c.node)
+		if c.redirect {
+			values.Set(queryParamRedirect, "")
+		}
+	}
+	res.RawQuery = values.Encode()
+	return
+}
+
+// do sends request with JSON body and decodes JSON response to v. Redirects
+// are followed with the same method and body. Responses with non-2xx status
+// are returned as *api_server.Error.
+func (c *Client) do(ctx context.Context, method, path string, body, v interface{}) (err error) {
+	var raw []byte
+	if body != nil {
+		if raw, err = json.Marshal(body); err != nil {
+			return
+		}
+	}
+	httpClient := *c.httpClient
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	target := c.URL(path)
+	var resp *http.Response
+	for i := 0; ; i++ {
+		if i > maxRedirects {
+			err = fmt.Errorf(`%s %s: stopped after %d redirects`, method, path, maxRedirects)
+			return
+		}
+		var req *http.Request
+		if req, err = http.NewRequest(method, target.String(), bytes.NewReader(raw)); err != nil {
+			return
+		}
+		if raw != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if resp, err = httpClient.Do(req.WithContext(ctx)); err != nil {
+			return
+		}
+		if !isRedirect(resp.StatusCode) {
+			break
+		}
+		location, locationErr := resp.Location()
+		drain(resp)
+		if locationErr != nil {
+			err = locationErr
+			return
+		}
+		target = location
+	}
+	defer drain(resp)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		reason, _ := ioutil.ReadAll(resp.Body)
+		err = api_server.NewError(resp.StatusCode, strings.TrimSpace(string(reason)))
+		return
+	}
+	if v != nil {
+		err = json.NewDecoder(resp.Body).Decode(v)
+	}
+	return
+}
+
+func isRedirect(code int) (ok bool) {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		ok = true
+	}
+	return
+}
+
+func drain(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
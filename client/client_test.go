@@ -0,0 +1,229 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/akaspin/logx"
+	"github.com/da-moon/soil/agent/api"
+	"github.com/da-moon/soil/agent/api/api-server"
+	"github.com/da-moon/soil/agent/bus"
+	"github.com/da-moon/soil/client"
+	"github.com/da-moon/soil/fixture"
+	"github.com/da-moon/soil/manifest"
+	"github.com/da-moon/soil/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAgent struct {
+	*httptest.Server
+	name     string
+	router   *api_server.Router
+	registry *bus.TestingConsumer
+	nodes    *api_server.Endpoint
+	pods     *api_server.Endpoint
+
+	mu      sync.Mutex
+	drain   []bool
+	reloads int
+}
+
+func newTestAgent(ctx context.Context, name string) (a *testAgent) {
+	log := logx.GetLog("test")
+	a = &testAgent{
+		name:     name,
+		registry: bus.NewTestingConsumer(ctx),
+		nodes:    api.NewClusterNodesGet(log),
+		pods:     api.NewRegistryPodsGet(),
+	}
+	drainFn := func(on bool) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.drain = append(a.drain, on)
+	}
+	a.router = api_server.NewRouter(log,
+		api.NewStatusPingGet(),
+		api.NewStatusNodeGet(func() proto.NodeStatus {
+			return proto.NodeStatus{ID: a.name, Version: "test", API: "v1"}
+		}),
+		a.nodes,
+		api.NewAgentReloadPut(func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.reloads++
+		}),
+		api.NewAgentDrainPut(drainFn),
+		api.NewAgentDrainDelete(drainFn),
+		api.NewAgentDriftGet(func() map[string][]string {
+			return map[string][]string{"1": {"/etc/1"}}
+		}),
+		api.NewProvidersGet(func() proto.ProvidersInfo {
+			return proto.ProvidersInfo{
+				{ID: a.name + ".port", Pod: a.name, Name: "port", Kind: "range", Used: 1, Total: 2},
+			}
+		}),
+		api.NewResourcesGet(func() proto.ResourcesInfo {
+			return proto.ResourcesInfo{
+				{ID: a.name + ".1", Pod: a.name, Name: "1", Provider: a.name + ".port", Allocated: true, Values: map[string]string{"value": "1"}},
+			}
+		}),
+		a.pods,
+		api.NewRegistryPodsPut(log, a.registry),
+		api.NewRegistryPodsDelete(log, a.registry),
+	)
+	a.Server = httptest.NewServer(a.router)
+	return
+}
+
+func (a *testAgent) setNodes(t *testing.T, nodes proto.NodesInfo) {
+	message := bus.NewMessage("nodes", nodes)
+	require.NoError(t, a.router.ConsumeMessage(message))
+	require.NoError(t, a.nodes.Processor().(bus.Consumer).ConsumeMessage(message))
+}
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := newTestAgent(ctx, "a")
+	defer a.Close()
+	b := newTestAgent(ctx, "b")
+	defer b.Close()
+
+	aURL, _ := url.Parse(a.URL)
+	bURL, _ := url.Parse(b.URL)
+	nodes := proto.NodesInfo{
+		{ID: "a", Advertise: aURL.Host, Version: "test", API: "v1"},
+		{ID: "b", Advertise: bURL.Host, Version: "test", API: "v1"},
+	}
+	a.setNodes(t, nodes)
+
+	cli, err := client.NewClient(aURL.Host)
+	require.NoError(t, err)
+
+	t.Run(`ping`, func(t *testing.T) {
+		assert.NoError(t, cli.Ping(ctx))
+	})
+	t.Run(`nodes`, func(t *testing.T) {
+		fixture.WaitNoErrorT10(t, func() error {
+			res, err := cli.Nodes(ctx)
+			if err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(res, nodes) {
+				return fmt.Errorf(`not equal: %v`, res)
+			}
+			return nil
+		})
+	})
+	t.Run(`status`, func(t *testing.T) {
+		res, err := cli.Status(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, proto.NodeStatus{ID: "a", Version: "test", API: "v1"}, res)
+	})
+	t.Run(`drift`, func(t *testing.T) {
+		res, err := cli.Drift(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]string{"1": {"/etc/1"}}, res)
+	})
+	t.Run(`providers and resources`, func(t *testing.T) {
+		providers, err := cli.Providers(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, proto.ProvidersInfo{
+			{ID: "a.port", Pod: "a", Name: "port", Kind: "range", Used: 1, Total: 2},
+		}, providers)
+		resources, err := cli.Resources(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, proto.ResourcesInfo{
+			{ID: "a.1", Pod: "a", Name: "1", Provider: "a.port", Allocated: true, Values: map[string]string{"value": "1"}},
+		}, resources)
+	})
+	t.Run(`registry`, func(t *testing.T) {
+		pods := manifest.PodSlice{
+			{Name: "1", Namespace: manifest.PublicNamespace},
+		}
+		require.NoError(t, a.pods.Processor().(bus.Consumer).ConsumeMessage(bus.NewMessage("registry", pods)))
+		res, err := cli.RegistryGet(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, pods, res)
+
+		assert.NoError(t, cli.RegistryPut(ctx, pods))
+		assert.NoError(t, cli.RegistryDelete(ctx, "1"))
+		fixture.WaitNoErrorT10(t, a.registry.ExpectMessagesFn(
+			bus.NewMessage("1", pods[0]),
+			bus.NewMessage("1", nil),
+		))
+	})
+	t.Run(`bad request`, func(t *testing.T) {
+		err := cli.RegistryPut(ctx, manifest.PodSlice{})
+		require.Error(t, err)
+		apiErr, ok := err.(*api_server.Error)
+		require.True(t, ok, "%T", err)
+		assert.Equal(t, http.StatusBadRequest, apiErr.Code)
+		assert.Contains(t, apiErr.Reason, "bad pods")
+	})
+	t.Run(`drain and reload`, func(t *testing.T) {
+		assert.NoError(t, cli.Drain(ctx, true))
+		assert.NoError(t, cli.Drain(ctx, false))
+		assert.NoError(t, cli.Reload(ctx))
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		assert.Equal(t, []bool{true, false}, a.drain)
+		assert.Equal(t, 1, a.reloads)
+	})
+	t.Run(`node not found`, func(t *testing.T) {
+		fixture.WaitNoErrorT10(t, func() error {
+			err := cli.WithOptions(client.WithNode("c")).Ping(ctx)
+			if apiErr, ok := err.(*api_server.Error); !ok || apiErr.Code != http.StatusNotFound {
+				return fmt.Errorf(`unexpected error: %v`, err)
+			}
+			return nil
+		})
+	})
+	for _, opts := range [][]client.Option{
+		{client.WithNode("b")},
+		{client.WithNode("b"), client.WithRedirect()},
+	} {
+		remote := cli.WithOptions(opts...)
+		t.Run(fmt.Sprintf(`remote %s`, remote.URL("/")), func(t *testing.T) {
+			fixture.WaitNoErrorT10(t, func() error {
+				return remote.Ping(ctx)
+			})
+			status, err := remote.Status(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, "b", status.ID)
+			resources, err := remote.Resources(ctx)
+			assert.NoError(t, err)
+			if assert.Len(t, resources, 1) {
+				assert.Equal(t, "b", resources[0].Pod)
+			}
+			assert.NoError(t, remote.Drain(ctx, true))
+			assert.NoError(t, remote.Reload(ctx))
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			assert.Equal(t, []bool{true}, b.drain)
+			assert.Equal(t, 1, b.reloads)
+			b.drain, b.reloads = nil, 0
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:7654", "http://127.0.0.1:7654"} {
+		cli, err := client.NewClient(address, client.WithNode("b"), client.WithRedirect())
+		assert.NoError(t, err)
+		assert.Equal(t, "http://127.0.0.1:7654/v1/status/ping?node=b&redirect=", cli.URL("/v1/status/ping").String())
+	}
+	_, err := client.NewClient("http://")
+	assert.Error(t, err)
+}
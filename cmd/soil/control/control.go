@@ -0,0 +1,80 @@
+package control
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/akaspin/cut"
+	"github.com/da-moon/soil/cmd/soil/options"
+	"github.com/spf13/cobra"
+)
+
+type Ping struct {
+	*cut.Environment
+	*options.ClientURLOptions
+}
+
+func (c *Ping) Bind(cc *cobra.Command) {
+	cc.Use = `ping`
+	cc.Short = "Check agent availability"
+	cc.Args = cobra.NoArgs
+}
+
+func (c *Ping) Run(args ...string) (err error) {
+	cli, err := c.Client()
+	if err != nil {
+		return
+	}
+	if err = cli.Ping(context.Background()); err != nil {
+		return
+	}
+	fmt.Fprintln(c.Stdout, "ok")
+	return
+}
+
+type Drain struct {
+	*cut.Environment
+	*options.ClientURLOptions
+}
+
+func (c *Drain) Bind(cc *cobra.Command) {
+	cc.Use = `drain on|off`
+	cc.Short = "Turn agent drain mode on or off"
+	cc.ValidArgs = []string{"on", "off"}
+	cc.Args = cobra.ExactValidArgs(1)
+}
+
+func (c *Drain) Run(args ...string) (err error) {
+	cli, err := c.Client()
+	if err != nil {
+		return
+	}
+	if err = cli.Drain(context.Background(), args[0] == "on"); err != nil {
+		return
+	}
+	fmt.Fprintln(c.Stdout, "ok")
+	return
+}
+
+type Reload struct {
+	*cut.Environment
+	*options.ClientURLOptions
+}
+
+func (c *Reload) Bind(cc *cobra.Command) {
+	cc.Use = `reload`
+	cc.Short = "Reload agent configuration"
+	cc.Args = cobra.NoArgs
+}
+
+func (c *Reload) Run(args ...string) (err error) {
+	cli, err := c.Client()
+	if err != nil {
+		return
+	}
+	if err = cli.Reload(context.Background()); err != nil {
+		return
+	}
+	fmt.Fprintln(c.Stdout, "ok")
+	return
+}
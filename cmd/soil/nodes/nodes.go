@@ -1,37 +1,45 @@
 package nodes
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"text/tabwriter"
+
 	"github.com/akaspin/cut"
+	"github.com/da-moon/soil/cmd/soil/options"
 	"github.com/spf13/cobra"
-	"net/http"
 )
 
-type ClientURLOptions struct {
-	URL      string
-	NodeID   string
-	Redirect bool
-}
-
-type ClientOutputOptions struct {
-}
-
 type Nodes struct {
 	*cut.Environment
-	*ClientURLOptions
+	*options.ClientURLOptions
+	*options.ClientOutputOptions
 }
 
 func (c *Nodes) Bind(cc *cobra.Command) {
 	cc.Use = `nodes`
 	cc.Short = "List nodes in cluster"
+	cc.Args = cobra.NoArgs
 }
 
 func (c *Nodes) Run(args ...string) (err error) {
-	p := fmt.Sprintf("%s/v1/status/nodes", c.ClientURLOptions.URL)
-	_, err = http.NewRequest(http.MethodGet, p, nil)
+	cli, err := c.Client()
 	if err != nil {
 		return
 	}
-
+	nodes, err := cli.Nodes(context.Background())
+	if err != nil {
+		return
+	}
+	err = c.Write(c.Stdout, nodes, func(w io.Writer) (err error) {
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tADVERTISE\tVERSION\tAPI")
+		for _, node := range nodes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", node.ID, node.Advertise, node.Version, node.API)
+		}
+		err = tw.Flush()
+		return
+	})
 	return
 }
@@ -0,0 +1,73 @@
+package options
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/da-moon/soil/client"
+	"github.com/da-moon/soil/internal/primitives"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+// ClientURLOptions configures Agent API client
+type ClientURLOptions struct {
+	URL      string // Agent address
+	NodeID   string // Route requests to node
+	Redirect bool   // Follow redirects instead of proxying
+}
+
+func (o *ClientURLOptions) Bind(cc *cobra.Command) {
+	cc.Flags().StringVarP(&o.URL, "address", "", "127.0.0.1:7654", "agent address")
+	cc.Flags().StringVarP(&o.NodeID, "node", "", "", "route request to node with given ID")
+	cc.Flags().BoolVarP(&o.Redirect, "redirect", "", false, "ask agent to redirect instead of proxying request to node")
+}
+
+// Client returns Agent API client
+func (o *ClientURLOptions) Client() (c *client.Client, err error) {
+	opts := []client.Option{
+		client.WithNode(o.NodeID),
+	}
+	if o.Redirect {
+		opts = append(opts, client.WithRedirect())
+	}
+	c, err = client.NewClient(o.URL, opts...)
+	return
+}
+
+// ClientOutputOptions configures command output
+type ClientOutputOptions struct {
+	Format string
+}
+
+func (o *ClientOutputOptions) Bind(cc *cobra.Command) {
+	cc.Flags().StringVarP(&o.Format, "format", "", FormatTable, "output format: table, json or yaml")
+}
+
+// Write writes value to w in configured format. Table format is written by
+// table function.
+func (o *ClientOutputOptions) Write(w io.Writer, v interface{}, table func(w io.Writer) error) (err error) {
+	var buf *bytes.Buffer
+	switch o.Format {
+	case FormatTable:
+		err = table(w)
+		return
+	case FormatJSON:
+		buf, err = primitives.IndentedJSON(v)
+	case FormatYAML:
+		buf, err = primitives.IndentedYAML(v)
+	default:
+		err = fmt.Errorf(`unknown format %s`, o.Format)
+	}
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(w, buf)
+	return
+}
@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/akaspin/cut"
+	"github.com/da-moon/soil/cmd/soil/options"
+	"github.com/da-moon/soil/manifest"
+	"github.com/spf13/cobra"
+)
+
+type Registry struct {
+	*cut.Environment
+}
+
+func (c *Registry) Bind(cc *cobra.Command) {
+	cc.Use = `registry`
+	cc.Short = "Manage pods in cluster registry"
+}
+
+type Get struct {
+	*cut.Environment
+	*options.ClientURLOptions
+	*options.ClientOutputOptions
+}
+
+func (c *Get) Bind(cc *cobra.Command) {
+	cc.Use = `get`
+	cc.Short = "List pods in cluster registry"
+	cc.Args = cobra.NoArgs
+}
+
+func (c *Get) Run(args ...string) (err error) {
+	cli, err := c.Client()
+	if err != nil {
+		return
+	}
+	pods, err := cli.RegistryGet(context.Background())
+	if err != nil {
+		return
+	}
+	err = c.Write(c.Stdout, pods, func(w io.Writer) (err error) {
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tNAMESPACE\tMARK\tUNITS\tBLOBS\tRESOURCES")
+		for _, pod := range pods {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\n", pod.Name, pod.Namespace, pod.Mark(), len(pod.Units), len(pod.Blobs), len(pod.Resources))
+		}
+		err = tw.Flush()
+		return
+	})
+	return
+}
+
+type Put struct {
+	*cut.Environment
+	*options.ClientURLOptions
+}
+
+func (c *Put) Bind(cc *cobra.Command) {
+	cc.Use = `put [file...]`
+	cc.Short = "Put pods from manifest files or stdin to cluster registry"
+}
+
+func (c *Put) Run(args ...string) (err error) {
+	var readers []io.Reader
+	for _, path := range args {
+		if path == "-" {
+			readers = append(readers, c.Stdin)
+			continue
+		}
+		var f *os.File
+		if f, err = os.Open(path); err != nil {
+			return
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	if len(readers) == 0 {
+		readers = append(readers, c.Stdin)
+	}
+	var pods manifest.PodSlice
+	if err = pods.Unmarshal(manifest.PublicNamespace, readers...); err != nil {
+		return
+	}
+	if len(pods) == 0 {
+		err = fmt.Errorf(`no pods found`)
+		return
+	}
+	cli, err := c.Client()
+	if err != nil {
+		return
+	}
+	if err = cli.RegistryPut(context.Background(), pods); err != nil {
+		return
+	}
+	for _, pod := range pods {
+		fmt.Fprintln(c.Stdout, pod.Name)
+	}
+	return
+}
+
+type Delete struct {
+	*cut.Environment
+	*options.ClientURLOptions
+}
+
+func (c *Delete) Bind(cc *cobra.Command) {
+	cc.Use = `delete pod...`
+	cc.Short = "Delete pods from cluster registry"
+	cc.Args = cobra.MinimumNArgs(1)
+}
+
+func (c *Delete) Run(args ...string) (err error) {
+	cli, err := c.Client()
+	if err != nil {
+		return
+	}
+	if err = cli.RegistryDelete(context.Background(), args...); err != nil {
+		return
+	}
+	for _, name := range args {
+		fmt.Fprintln(c.Stdout, name)
+	}
+	return
+}
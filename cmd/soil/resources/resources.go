@@ -0,0 +1,93 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/akaspin/cut"
+	"github.com/da-moon/soil/cmd/soil/options"
+	"github.com/spf13/cobra"
+)
+
+type Resources struct {
+	*cut.Environment
+	*options.ClientURLOptions
+	*options.ClientOutputOptions
+}
+
+func (c *Resources) Bind(cc *cobra.Command) {
+	cc.Use = `resources`
+	cc.Short = "List resources with allocation states on agent"
+	cc.Args = cobra.NoArgs
+}
+
+func (c *Resources) Run(args ...string) (err error) {
+	cli, err := c.Client()
+	if err != nil {
+		return
+	}
+	resources, err := cli.Resources(context.Background())
+	if err != nil {
+		return
+	}
+	err = c.Write(c.Stdout, resources, func(w io.Writer) (err error) {
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tPROVIDER\tALLOCATED\tVALUES")
+		for _, resource := range resources {
+			values := resource.Failure
+			if resource.Allocated {
+				var pairs []string
+				for k, v := range resource.Values {
+					pairs = append(pairs, k+"="+v)
+				}
+				sort.Strings(pairs)
+				values = strings.Join(pairs, ",")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%t\t%s\n", resource.ID, resource.Provider, resource.Allocated, values)
+		}
+		err = tw.Flush()
+		return
+	})
+	return
+}
+
+type Providers struct {
+	*cut.Environment
+	*options.ClientURLOptions
+	*options.ClientOutputOptions
+}
+
+func (c *Providers) Bind(cc *cobra.Command) {
+	cc.Use = `providers`
+	cc.Short = "List resource providers with utilisation on agent"
+	cc.Args = cobra.NoArgs
+}
+
+func (c *Providers) Run(args ...string) (err error) {
+	cli, err := c.Client()
+	if err != nil {
+		return
+	}
+	providers, err := cli.Providers(context.Background())
+	if err != nil {
+		return
+	}
+	err = c.Write(c.Stdout, providers, func(w io.Writer) (err error) {
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tKIND\tUSED\tFAILED\tTOTAL")
+		for _, provider := range providers {
+			total := "-"
+			if provider.Total > 0 {
+				total = fmt.Sprint(provider.Total)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", provider.ID, provider.Kind, provider.Used, provider.Failed, total)
+		}
+		err = tw.Flush()
+		return
+	})
+	return
+}
@@ -3,6 +3,13 @@ package main
 import (
 	"github.com/akaspin/cut"
 	agent "github.com/da-moon/soil/cmd/soil/agent"
+	control "github.com/da-moon/soil/cmd/soil/control"
+	nodes "github.com/da-moon/soil/cmd/soil/nodes"
+	options "github.com/da-moon/soil/cmd/soil/options"
+	registry "github.com/da-moon/soil/cmd/soil/registry"
+	resources "github.com/da-moon/soil/cmd/soil/resources"
+	secret "github.com/da-moon/soil/cmd/soil/secret"
+	state "github.com/da-moon/soil/cmd/soil/state"
 	version "github.com/da-moon/soil/cmd/soil/version"
 	"github.com/spf13/cobra"
 	"io"
@@ -23,6 +30,10 @@ func run(stderr, stdout io.Writer, stdin io.Reader, args ...string) (err error)
 		Stdout: stdout,
 	}
 	configs := &agent.AgentOptions{}
+	encryptOptions := &secret.EncryptOptions{}
+	stateOptions := &state.StateOptions{}
+	clientOptions := &options.ClientURLOptions{}
+	outputOptions := &options.ClientOutputOptions{}
 
 	cmd := cut.Attach(
 		&Soil{env}, []cut.Binder{env},
@@ -32,6 +43,94 @@ func run(stderr, stdout io.Writer, stdin io.Reader, args ...string) (err error)
 				AgentOptions: configs,
 			}, []cut.Binder{configs},
 		),
+		cut.Attach(
+			&secret.Secret{Environment: env}, nil,
+			cut.Attach(
+				&secret.Encrypt{
+					Environment:    env,
+					EncryptOptions: encryptOptions,
+				}, []cut.Binder{encryptOptions},
+			),
+			cut.Attach(
+				&secret.Keygen{Environment: env}, nil,
+			),
+		),
+		cut.Attach(
+			&state.State{Environment: env}, nil,
+			cut.Attach(
+				&state.Show{
+					Environment:  env,
+					StateOptions: stateOptions,
+				}, []cut.Binder{stateOptions},
+			),
+			cut.Attach(
+				&state.Verify{
+					Environment:  env,
+					StateOptions: stateOptions,
+				}, []cut.Binder{stateOptions},
+			),
+		),
+		cut.Attach(
+			&nodes.Nodes{
+				Environment:         env,
+				ClientURLOptions:    clientOptions,
+				ClientOutputOptions: outputOptions,
+			}, []cut.Binder{clientOptions, outputOptions},
+		),
+		cut.Attach(
+			&registry.Registry{Environment: env}, nil,
+			cut.Attach(
+				&registry.Get{
+					Environment:         env,
+					ClientURLOptions:    clientOptions,
+					ClientOutputOptions: outputOptions,
+				}, []cut.Binder{clientOptions, outputOptions},
+			),
+			cut.Attach(
+				&registry.Put{
+					Environment:      env,
+					ClientURLOptions: clientOptions,
+				}, []cut.Binder{clientOptions},
+			),
+			cut.Attach(
+				&registry.Delete{
+					Environment:      env,
+					ClientURLOptions: clientOptions,
+				}, []cut.Binder{clientOptions},
+			),
+		),
+		cut.Attach(
+			&resources.Resources{
+				Environment:         env,
+				ClientURLOptions:    clientOptions,
+				ClientOutputOptions: outputOptions,
+			}, []cut.Binder{clientOptions, outputOptions},
+		),
+		cut.Attach(
+			&resources.Providers{
+				Environment:         env,
+				ClientURLOptions:    clientOptions,
+				ClientOutputOptions: outputOptions,
+			}, []cut.Binder{clientOptions, outputOptions},
+		),
+		cut.Attach(
+			&control.Drain{
+				Environment:      env,
+				ClientURLOptions: clientOptions,
+			}, []cut.Binder{clientOptions},
+		),
+		cut.Attach(
+			&control.Reload{
+				Environment:      env,
+				ClientURLOptions: clientOptions,
+			}, []cut.Binder{clientOptions},
+		),
+		cut.Attach(
+			&control.Ping{
+				Environment:      env,
+				ClientURLOptions: clientOptions,
+			}, []cut.Binder{clientOptions},
+		),
 		cut.Attach(
 			&version.Version{env}, nil,
 		),
@@ -0,0 +1,86 @@
+package secret
+
+import (
+	"fmt"
+	"github.com/akaspin/cut"
+	"github.com/da-moon/soil/manifest"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"strings"
+)
+
+type Secret struct {
+	*cut.Environment
+}
+
+func (c *Secret) Bind(cc *cobra.Command) {
+	cc.Use = `secret`
+	cc.Short = "Manage pod secrets"
+}
+
+type EncryptOptions struct {
+	PublicKey string
+}
+
+func (o *EncryptOptions) Bind(cc *cobra.Command) {
+	cc.Flags().StringVarP(&o.PublicKey, "key", "", "", "base64 encoded cluster public key")
+}
+
+type Encrypt struct {
+	*cut.Environment
+	*EncryptOptions
+}
+
+func (c *Encrypt) Bind(cc *cobra.Command) {
+	cc.Use = `encrypt [value]`
+	cc.Short = "Encrypt value with public key. Value is read from stdin if not given"
+}
+
+func (c *Encrypt) Run(args ...string) (err error) {
+	if c.PublicKey == "" {
+		err = fmt.Errorf(`--key is required`)
+		return
+	}
+	key, err := manifest.ParseSecretPublicKey(c.PublicKey)
+	if err != nil {
+		return
+	}
+	var plaintext string
+	switch len(args) {
+	case 0:
+		var raw []byte
+		if raw, err = ioutil.ReadAll(c.Stdin); err != nil {
+			return
+		}
+		plaintext = strings.TrimSuffix(string(raw), "\n")
+	case 1:
+		plaintext = args[0]
+	default:
+		err = fmt.Errorf(`expected at most one value`)
+		return
+	}
+	res, err := key.Encrypt(plaintext)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(c.Stdout, res)
+	return
+}
+
+type Keygen struct {
+	*cut.Environment
+}
+
+func (c *Keygen) Bind(cc *cobra.Command) {
+	cc.Use = `keygen`
+	cc.Short = "Generate key pair. Private key is for agent config and public key is for encryption"
+}
+
+func (c *Keygen) Run(args ...string) (err error) {
+	key, err := manifest.GenerateSecretKey()
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(c.Stdout, "private: %s\npublic: %s\n", key.PrivateString(), key.PublicString())
+	return
+}
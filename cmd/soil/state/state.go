@@ -0,0 +1,308 @@
+package state
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/akaspin/cut"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/internal/primitives"
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+type State struct {
+	*cut.Environment
+}
+
+func (c *State) Bind(cc *cobra.Command) {
+	cc.Use = `state`
+	cc.Short = "Inspect allocations recovered from pod units without dbus"
+}
+
+type StateOptions struct {
+	Local    string // Systemd local directory
+	Runtime  string // Systemd runtime directory
+	StateDir string // Agent state directory
+	Dir      string // Root of offline filesystem copy to inspect instead of live host
+	Format   string
+}
+
+func (o *StateOptions) Bind(cc *cobra.Command) {
+	cc.Flags().StringVarP(&o.Local, "local", "", "/etc/systemd/system", "systemd local directory")
+	cc.Flags().StringVarP(&o.Runtime, "runtime", "", "/run/systemd/system", "systemd runtime directory")
+	cc.Flags().StringVarP(&o.StateDir, "state-dir", "", "/var/lib/soil", "agent state directory")
+	cc.Flags().StringVarP(&o.Dir, "dir", "", "", "root of offline filesystem copy to inspect instead of live host")
+	cc.Flags().StringVarP(&o.Format, "format", "", formatTable, "output format: table or json")
+}
+
+func (o *StateOptions) systemPaths() (res allocation.SystemPaths) {
+	res = allocation.SystemPaths{
+		Local:   o.Local,
+		Runtime: o.Runtime,
+	}.WithRoot(o.Dir)
+	return
+}
+
+// discover returns recorded paths of pod units
+func (o *StateOptions) discover() (paths []string, err error) {
+	systemPaths := o.systemPaths()
+	found, err := allocation.GetGlobDiscoveryFunc(systemPaths.Resolve(systemPaths.Local), systemPaths.Resolve(systemPaths.Runtime))()
+	for _, path := range found {
+		if o.Dir != "" {
+			rel, relErr := filepath.Rel(o.Dir, path)
+			if relErr != nil {
+				continue
+			}
+			path = string(filepath.Separator) + rel
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return
+}
+
+// store returns agent state store or <nil> if store is not initialized
+func (o *StateOptions) store() (res *allocation.Store) {
+	if o.StateDir == "" {
+		return
+	}
+	systemPaths := o.systemPaths()
+	if res = allocation.NewStore(systemPaths.Resolve(o.StateDir), systemPaths); !res.IsInitialized() {
+		res = nil
+	}
+	return
+}
+
+// recover returns pods in the same way as agent: from state store if it is
+// initialized or from pod units
+func (o *StateOptions) recover() (pods allocation.PodSlice, err error) {
+	if store := o.store(); store != nil {
+		pods, err = store.Load()
+	} else {
+		err = pods.FromFilesystem(o.systemPaths(), o.discover)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	return
+}
+
+// missing returns files recorded in pod which are not present
+func (o *StateOptions) missing(pod *allocation.Pod) (res []string) {
+	systemPaths := o.systemPaths()
+	check := func(path string) {
+		if _, statErr := os.Lstat(systemPaths.Resolve(path)); statErr != nil {
+			res = append(res, path)
+		}
+	}
+	if pod.Mode != allocation.ModeTransient {
+		check(pod.UnitFile.Path)
+	}
+	for _, u := range pod.Units {
+		if !u.Foreign && !u.Transient {
+			check(u.UnitFile.Path)
+		}
+		for _, d := range u.DropIns {
+			check(d.Path)
+		}
+	}
+	for _, b := range pod.Blobs {
+		if !b.IsArchive() {
+			check(b.Name)
+			continue
+		}
+		for _, p := range b.Paths {
+			check(filepath.Join(b.Name, p))
+		}
+	}
+	return
+}
+
+type Show struct {
+	*cut.Environment
+	*StateOptions
+}
+
+func (c *Show) Bind(cc *cobra.Command) {
+	cc.Use = `show [pod]`
+	cc.Short = "Show recovered pods"
+	cc.Args = cobra.MaximumNArgs(1)
+}
+
+func (c *Show) Run(args ...string) (err error) {
+	pods, recoveryErr := c.recover()
+	if recoveryErr != nil {
+		fmt.Fprintf(c.Stderr, "recovered with failures: %v\n", recoveryErr)
+	}
+	if len(args) > 0 {
+		var filtered allocation.PodSlice
+		for _, pod := range pods {
+			if pod.Name == args[0] {
+				filtered = append(filtered, pod)
+			}
+		}
+		if len(filtered) == 0 {
+			err = fmt.Errorf(`pod %s not found`, args[0])
+			return
+		}
+		pods = filtered
+	}
+	switch c.Format {
+	case formatJSON:
+		buf, encodeErr := primitives.IndentedJSON(pods)
+		if encodeErr != nil {
+			err = encodeErr
+			return
+		}
+		_, err = io.Copy(c.Stdout, buf)
+	case formatTable:
+		err = writeTable(c.Stdout, pods)
+	default:
+		err = fmt.Errorf(`unknown format %s`, c.Format)
+	}
+	return
+}
+
+func writeTable(w io.Writer, pods allocation.PodSlice) (err error) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for i, pod := range pods {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "POD\t%s\tnamespace=%s pod-mark=%d agent-mark=%d\n", pod.Name, pod.Namespace, pod.PodMark, pod.AgentMark)
+		fmt.Fprintf(tw, "path\t%s\t%s\n", pod.UnitFile.Path, podAttributes(pod))
+		for _, u := range pod.Units {
+			fmt.Fprintf(tw, "unit\t%s\tcreate=%s update=%s destroy=%s permanent=%t%s\n",
+				u.UnitFile.Path, u.Create, u.Update, u.Destroy, u.Permanent, unitAttributes(u))
+			for _, d := range u.DropIns {
+				fmt.Fprintf(tw, "dropin\t%s\t\n", d.Path)
+			}
+		}
+		for _, b := range pod.Blobs {
+			fmt.Fprintf(tw, "blob\t%s\tpermissions=%#o leave=%t%s\n", b.Name, b.Permissions, b.Leave, blobAttributes(b))
+		}
+		for _, r := range pod.Resources {
+			fmt.Fprintf(tw, "resource\t%s\tprovider=%s values=%s\n", r.Request.Name, r.Request.Provider, formatMap(r.Values))
+		}
+		for _, p := range pod.Providers {
+			fmt.Fprintf(tw, "provider\t%s\tkind=%s config=%v\n", p.Name, p.Kind, p.Config)
+		}
+	}
+	err = tw.Flush()
+	return
+}
+
+func podAttributes(pod *allocation.Pod) (res string) {
+	var attrs []string
+	if pod.User != "" {
+		attrs = append(attrs, "user="+pod.User)
+	}
+	if pod.Mode != "" {
+		attrs = append(attrs, "mode="+pod.Mode)
+	}
+	res = strings.Join(attrs, " ")
+	return
+}
+
+func unitAttributes(u *allocation.Unit) (res string) {
+	if u.Foreign {
+		res += " foreign=true"
+	}
+	if u.Transient {
+		res += " transient=true"
+	}
+	return
+}
+
+func blobAttributes(b *allocation.Blob) (res string) {
+	if b.Kind != "" {
+		res += fmt.Sprintf(" kind=%s paths=%d", b.Kind, len(b.Paths))
+	}
+	if b.Owner != "" || b.Group != "" {
+		res += fmt.Sprintf(" owner=%s group=%s", b.Owner, b.Group)
+	}
+	return
+}
+
+func formatMap(m map[string]string) (res string) {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var chunks []string
+	for _, k := range keys {
+		chunks = append(chunks, k+"="+m[k])
+	}
+	res = strings.Join(chunks, ",")
+	return
+}
+
+type Verify struct {
+	*cut.Environment
+	*StateOptions
+}
+
+func (c *Verify) Bind(cc *cobra.Command) {
+	cc.Use = `verify`
+	cc.Short = "Report pod unit parse errors and missing files"
+}
+
+func (c *Verify) Run(args ...string) (err error) {
+	paths, err := c.discover()
+	if err != nil {
+		return
+	}
+	var total, failed int
+	report := func(source string, pod *allocation.Pod, parseErr error) {
+		total++
+		if parseErr != nil {
+			failed++
+			fmt.Fprintf(c.Stdout, "FAIL\t%s\t%v\n", source, parseErr)
+			return
+		}
+		if missing := c.missing(pod); len(missing) > 0 {
+			failed++
+			fmt.Fprintf(c.Stdout, "FAIL\t%s\tmissing files: %s\n", source, strings.Join(missing, ", "))
+			return
+		}
+		fmt.Fprintf(c.Stdout, "OK\t%s\t%s\n", source, pod.Name)
+	}
+	for _, path := range paths {
+		pod := &allocation.Pod{
+			UnitFile: allocation.UnitFile{
+				SystemPaths: c.systemPaths(),
+			},
+		}
+		report(path, pod, pod.FromFilesystem(path))
+	}
+	if store := c.store(); store != nil {
+		pods, loadErr := store.Load()
+		if loadErr != nil {
+			for _, recordErr := range loadErr.(*multierror.Error).Errors {
+				report(store.Dir, nil, recordErr)
+			}
+		}
+		sort.Slice(pods, func(i, j int) bool {
+			return pods[i].Name < pods[j].Name
+		})
+		for _, pod := range pods {
+			report("store:"+pod.Name, pod, nil)
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf(`%d of %d pods failed verification`, failed, total)
+	}
+	return
+}
@@ -0,0 +1,143 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package state_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/akaspin/cut"
+	"github.com/da-moon/soil/agent/allocation"
+	"github.com/da-moon/soil/cmd/soil/state"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newOfflineCopy writes regular and transient pods to offline filesystem
+// copy and its state store
+func newOfflineCopy(t *testing.T) (root string) {
+	t.Helper()
+	root, err := ioutil.TempDir("", "soil-state")
+	require.NoError(t, err)
+	paths := allocation.SystemPaths{
+		Local:   "/etc/systemd/system",
+		Runtime: "/run/systemd/system",
+	}
+	env := map[string]string{
+		"system.pod_exec": "ExecStart=/usr/bin/sleep inf",
+	}
+	write := func(path, source string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, path), []byte(source), 0644))
+	}
+
+	regular := &allocation.Pod{UnitFile: allocation.UnitFile{SystemPaths: paths}}
+	require.NoError(t, regular.FromManifest(&manifest.Pod{
+		Namespace: "private",
+		Name:      "web",
+		Runtime:   true,
+		Target:    "multi-user.target",
+		Units: manifest.Units{
+			{Name: "web.service", Source: "[Service]\nExecStart=/usr/bin/web\n"},
+		},
+		Blobs: manifest.Blobs{
+			{Name: "/soil-state-test/web.conf", Permissions: 0644, Source: "listen"},
+		},
+	}, env))
+	write(regular.UnitFile.Path, regular.UnitFile.Source)
+	write(regular.Units[0].UnitFile.Path, regular.Units[0].UnitFile.Source)
+	write(regular.Blobs[0].Name, regular.Blobs[0].Source)
+
+	transient := &allocation.Pod{UnitFile: allocation.UnitFile{SystemPaths: paths}}
+	require.NoError(t, transient.FromManifest(&manifest.Pod{
+		Namespace: "private",
+		Name:      "job",
+		Mode:      allocation.ModeTransient,
+		Target:    "multi-user.target",
+		Units: manifest.Units{
+			{Name: "job.service", Source: "[Service]\nExecStart=/usr/bin/job\n"},
+		},
+	}, env))
+
+	store := allocation.NewStore(filepath.Join(root, "var/lib/soil"), paths)
+	require.NoError(t, store.Migrate(allocation.PodSlice{regular, transient}))
+	return
+}
+
+func TestShow(t *testing.T) {
+	root := newOfflineCopy(t)
+	defer os.RemoveAll(root)
+
+	var stdout, stderr bytes.Buffer
+	show := &state.Show{
+		Environment: &cut.Environment{Stdout: &stdout, Stderr: &stderr},
+		StateOptions: &state.StateOptions{
+			Local:    "/etc/systemd/system",
+			Runtime:  "/run/systemd/system",
+			StateDir: "/var/lib/soil",
+			Dir:      root,
+			Format:   "json",
+		},
+	}
+	require.NoError(t, show.Run())
+	assert.Empty(t, stderr.String())
+	var pods []struct {
+		Name  string
+		Units []struct {
+			Path      string
+			Transient bool
+		}
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &pods))
+	require.Len(t, pods, 2)
+	assert.Equal(t, "job", pods[0].Name)
+	assert.True(t, pods[0].Units[0].Transient)
+	assert.Equal(t, "web", pods[1].Name)
+	assert.Equal(t, "/run/systemd/system/web.service", pods[1].Units[0].Path)
+
+	stdout.Reset()
+	show.Format = "table"
+	require.NoError(t, show.Run("web"))
+	assert.Contains(t, stdout.String(), "/soil-state-test/web.conf")
+	assert.NotContains(t, stdout.String(), "job")
+}
+
+func TestVerify(t *testing.T) {
+	root := newOfflineCopy(t)
+	defer os.RemoveAll(root)
+
+	var stdout bytes.Buffer
+	verify := &state.Verify{
+		Environment: &cut.Environment{Stdout: &stdout, Stderr: &stdout},
+		StateOptions: &state.StateOptions{
+			Local:    "/etc/systemd/system",
+			Runtime:  "/run/systemd/system",
+			StateDir: "/var/lib/soil",
+			Dir:      root,
+		},
+	}
+	t.Run("ok", func(t *testing.T) {
+		require.NoError(t, verify.Run())
+		assert.Equal(t, []string{
+			"OK\t/run/systemd/system/pod-private-web.service\tweb",
+			"OK\tstore:job\tjob",
+			"OK\tstore:web\tweb",
+		}, strings.Split(strings.TrimSpace(stdout.String()), "\n"))
+	})
+	t.Run("missing blob", func(t *testing.T) {
+		stdout.Reset()
+		require.NoError(t, os.Remove(filepath.Join(root, "soil-state-test/web.conf")))
+		assert.EqualError(t, verify.Run(), "2 of 3 pods failed verification")
+		out := stdout.String()
+		assert.Contains(t, out, "FAIL\t/run/systemd/system/pod-private-web.service\t")
+		assert.Contains(t, out, "open "+filepath.Join(root, "soil-state-test/web.conf")+": no such file or directory")
+		assert.Contains(t, out, "OK\tstore:job\tjob")
+		assert.Contains(t, out, "FAIL\tstore:web\tmissing files: /soil-state-test/web.conf")
+	})
+}
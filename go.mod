@@ -18,6 +18,7 @@ require (
 	github.com/fatih/motion v1.1.0
 	github.com/go-delve/delve v1.7.0
 	github.com/go-git/go-git/v5 v5.4.2
+	github.com/godbus/dbus/v5 v5.0.4
 	github.com/gogo/protobuf v1.3.2
 	github.com/golang/protobuf v1.5.2
 	github.com/golangci/golangci-lint v1.41.1
@@ -45,6 +46,7 @@ require (
 	github.com/stretchr/testify v1.7.0
 	github.com/twitchtv/twirp v8.1.0+incompatible
 	github.com/verloop/twirpy/protoc-gen-twirpy v0.0.0-20210816030506-2c780803768f
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b
 	golang.org/x/lint v0.0.0-20210508222113-6edffad5e616
 	golang.org/x/tools v0.1.6-0.20210802203754-9b21a8868e16
 	golang.org/x/tools/gopls v0.7.1
@@ -1,11 +1,25 @@
 package manifest
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/copystructure"
+	"hash/crc64"
+	"io/ioutil"
 	"strings"
 )
 
+const (
+	BlobEncodingBase64     = "base64"
+	BlobEncodingGzipBase64 = "gzip+base64"
+
+	BlobKindArchive = "archive"
+)
+
 type Blobs []Blob
 
 func (b *Blobs) Empty() ObjectParser {
@@ -22,10 +36,18 @@ func (b *Blobs) Append(v interface{}) (err error) {
 
 // Pod file
 type Blob struct {
-	Name        string
-	Permissions int  `json:",omitempty"`
-	Leave       bool `json:",omitempty"`
-	Source      string
+	Name           string
+	Permissions    int    `json:",omitempty"`
+	DirPermissions int    `json:",omitempty" hcl:"dir_permissions"` // Permissions of created parent directories
+	Owner          string `json:",omitempty"`                       // User name or uid
+	Group          string `json:",omitempty"`                       // Group name or gid
+	SHA256         string `json:",omitempty" hcl:"sha256"`          // Expected checksum of interpolated source
+	Leave          bool   `json:",omitempty"`
+	Encoding       string `json:",omitempty"`                   // Source encoding. Encoded sources are not interpolated
+	Kind           string `json:",omitempty"`                   // Empty for file or "archive"
+	SourceFile     string `json:",omitempty" hcl:"source_file"` // Local file to read source from
+	SourceMark     uint64 `json:",omitempty" hcl:"-"`           // Checksum of source file content
+	Source         string
 }
 
 func (b Blob) GetID(parent ...string) string {
@@ -34,7 +56,117 @@ func (b Blob) GetID(parent ...string) string {
 
 func (b *Blob) ParseAST(raw *ast.ObjectItem) (err error) {
 	b.Name = raw.Keys[0].Token.Value().(string)
-	err = hcl.DecodeObject(b, raw)
-	b.Source = Heredoc(b.Source)
+	if err = hcl.DecodeObject(b, raw); err != nil {
+		return
+	}
+	switch b.Kind {
+	case "":
+	case BlobKindArchive:
+		if b.Encoding == "" && b.SourceFile == "" {
+			err = fmt.Errorf(`blob %s: archive requires encoding or source_file`, b.Name)
+			return
+		}
+	default:
+		err = fmt.Errorf(`blob %s: unknown kind %s`, b.Name, b.Kind)
+		return
+	}
+	if b.SourceFile != "" {
+		if b.Source != "" {
+			err = fmt.Errorf(`blob %s: source and source_file are mutually exclusive`, b.Name)
+		}
+		return
+	}
+	switch b.Encoding {
+	case "":
+		b.Source = Heredoc(b.Source)
+	case BlobEncodingBase64, BlobEncodingGzipBase64:
+		_, err = b.Decode()
+	default:
+		err = fmt.Errorf(`blob %s: unknown encoding %s`, b.Name, b.Encoding)
+	}
+	return
+}
+
+// IsRaw returns true if blob source should not be interpolated
+func (b Blob) IsRaw() (ok bool) {
+	ok = b.Encoding != "" || b.Kind == BlobKindArchive
+	return
+}
+
+// ReadSource returns blob source. Source is read from source file if
+// defined.
+func (b Blob) ReadSource() (res string, err error) {
+	if b.SourceFile == "" {
+		res = b.Source
+		return
+	}
+	raw, err := ioutil.ReadFile(b.SourceFile)
+	if err != nil {
+		err = fmt.Errorf(`blob %s: %v`, b.Name, err)
+		return
+	}
+	res = string(raw)
+	return
+}
+
+// MarkSourceFiles returns registry with source file checksums set in blobs
+// with "source_file". Pods with changed source files get new marks and will
+// be reallocated. Pods without source files are returned as is.
+func (r PodSlice) MarkSourceFiles() (res PodSlice) {
+	for _, pod := range r {
+		var marked *Pod
+		for i, b := range pod.Blobs {
+			if b.SourceFile == "" {
+				continue
+			}
+			if marked == nil {
+				v, _ := copystructure.Copy(pod)
+				marked = v.(*Pod)
+			}
+			var mark uint64
+			if raw, err := ioutil.ReadFile(b.SourceFile); err == nil {
+				mark = crc64.Checksum(raw, crc64.MakeTable(crc64.ECMA))
+			}
+			marked.Blobs[i].SourceMark = mark
+		}
+		if marked == nil {
+			marked = pod
+		}
+		res = append(res, marked)
+	}
+	return
+}
+
+// Decode returns decoded blob source. Whitespaces in encoded source are
+// ignored.
+func (b Blob) Decode() (res string, err error) {
+	res, err = b.DecodeSource(b.Source)
+	return
+}
+
+// DecodeSource decodes given source with blob encoding
+func (b Blob) DecodeSource(source string) (res string, err error) {
+	if b.Encoding == "" {
+		res = source
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(source), ""))
+	if err != nil {
+		err = fmt.Errorf(`blob %s: %v`, b.Name, err)
+		return
+	}
+	if b.Encoding == BlobEncodingGzipBase64 {
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(raw)); err != nil {
+			err = fmt.Errorf(`blob %s: %v`, b.Name, err)
+			return
+		}
+		defer r.Close()
+		if raw, err = ioutil.ReadAll(r); err != nil {
+			err = fmt.Errorf(`blob %s: %v`, b.Name, err)
+			return
+		}
+	}
+	res = string(raw)
 	return
 }
@@ -0,0 +1,50 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package manifest_test
+
+import (
+	"github.com/da-moon/soil/lib"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBlob_Decode(t *testing.T) {
+	var buffers lib.StaticBuffers
+	var pods manifest.PodSlice
+	assert.NoError(t, buffers.ReadFiles("testdata/TestBlob_Encoding_0.hcl"))
+	assert.Error(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+	assert.Len(t, pods, 1)
+
+	for _, b := range pods[0].Blobs {
+		t.Run(b.Name, func(t *testing.T) {
+			res, err := b.Decode()
+			assert.NoError(t, err)
+			assert.Equal(t, "hello\x00world", res)
+		})
+	}
+	assert.Equal(t, "H4sIAAAAAAACA8tIzcnJZyjPL8pJAQCzFOYKCwAAAA==", pods[0].Blobs[0].Source, "source should be kept encoded")
+}
+
+func TestBlob_SourceFile(t *testing.T) {
+	var buffers lib.StaticBuffers
+	var pods manifest.PodSlice
+	assert.NoError(t, buffers.ReadFiles("testdata/TestBlob_SourceFile_0.hcl"))
+	assert.Error(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+	assert.Len(t, pods, 1)
+	assert.Equal(t, manifest.BlobKindArchive, pods[0].Blobs[1].Kind)
+
+	t.Run(`read`, func(t *testing.T) {
+		res, err := pods[0].Blobs[0].ReadSource()
+		assert.NoError(t, err)
+		assert.Equal(t, "hello ${meta.name}\n", res)
+	})
+	t.Run(`mark`, func(t *testing.T) {
+		marked := pods.MarkSourceFiles()
+		assert.NotEqual(t, uint64(0), marked[0].Blobs[0].SourceMark)
+		assert.Equal(t, uint64(0), pods[0].Blobs[0].SourceMark, "source pod should be intact")
+		assert.NotEqual(t, pods[0].Mark(), marked[0].Mark())
+		assert.Equal(t, marked[0].Mark(), marked.MarkSourceFiles()[0].Mark(), "mark should be stable")
+	})
+}
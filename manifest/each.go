@@ -0,0 +1,132 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mitchellh/copystructure"
+	"strings"
+)
+
+const eachKey = "each"
+
+// Expand returns registry with pods defined by "for_each" expanded to one pod
+// per element. "for_each" is interpolated with given environment and then
+// split by comma. Pods without "for_each" are returned as is.
+func (r PodSlice) Expand(env map[string]string) (res PodSlice, err error) {
+	err = &multierror.Error{}
+	names := map[string]struct{}{}
+	for _, pod := range r {
+		if pod.ForEach == "" {
+			res = append(res, pod)
+			names[pod.Name] = struct{}{}
+			continue
+		}
+		for _, element := range pod.Elements(env) {
+			expanded := pod.expand(element)
+			if _, ok := names[expanded.Name]; ok {
+				err = multierror.Append(err, fmt.Errorf(`pod %s: %s already defined`, pod.Name, expanded.Name))
+				continue
+			}
+			names[expanded.Name] = struct{}{}
+			res = append(res, expanded)
+		}
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+// Elements returns "for_each" elements interpolated with given environment.
+// Unresolved interpolations produce no elements.
+func (p *Pod) Elements(env map[string]string) (res []string) {
+	raw := Interpolate(p.ForEach, env)
+	if len(ExtractEnv(raw)) > 0 {
+		return
+	}
+	for _, chunk := range strings.Split(raw, ",") {
+		if element := strings.TrimSpace(chunk); element != "" {
+			res = append(res, element)
+		}
+	}
+	return
+}
+
+// expand returns pod clone with ${each} interpolated
+func (p *Pod) expand(element string) (res *Pod) {
+	v, _ := copystructure.Copy(p)
+	res = v.(*Pod)
+	env := map[string]string{
+		eachKey: element,
+	}
+	res.ForEach = ""
+	res.Each = element
+	res.Name = Interpolate(res.Name, env)
+	res.Target = Interpolate(res.Target, env)
+	if res.Constraint != nil {
+		constraint := Constraint{}
+		for left, right := range res.Constraint {
+			constraint[Interpolate(left, env)] = Interpolate(right, env)
+		}
+		res.Constraint = constraint
+	}
+	for i := range res.Units {
+		res.Units[i].Name = Interpolate(res.Units[i].Name, env)
+		res.Units[i].Source = Interpolate(res.Units[i].Source, env)
+		for j := range res.Units[i].DropIns {
+			res.Units[i].DropIns[j].Name = Interpolate(res.Units[i].DropIns[j].Name, env)
+			res.Units[i].DropIns[j].Source = Interpolate(res.Units[i].DropIns[j].Source, env)
+		}
+	}
+	for i := range res.Blobs {
+		res.Blobs[i].Name = Interpolate(res.Blobs[i].Name, env)
+		res.Blobs[i].SourceFile = Interpolate(res.Blobs[i].SourceFile, env)
+		if !res.Blobs[i].IsRaw() {
+			res.Blobs[i].Source = Interpolate(res.Blobs[i].Source, env)
+		}
+	}
+	for i := range res.Resources {
+		res.Resources[i].Name = Interpolate(res.Resources[i].Name, env)
+		res.Resources[i].Provider = Interpolate(res.Resources[i].Provider, env)
+		res.Resources[i].Config = interpolateConfig(res.Resources[i].Config, env).(map[string]interface{})
+	}
+	for i := range res.Providers {
+		res.Providers[i].Name = Interpolate(res.Providers[i].Name, env)
+		res.Providers[i].Config = interpolateConfig(res.Providers[i].Config, env).(map[string]interface{})
+	}
+	for i := range res.Secrets {
+		res.Secrets[i].Name = Interpolate(res.Secrets[i].Name, env)
+	}
+	return
+}
+
+// interpolateConfig interpolates all strings in decoded HCL value
+func interpolateConfig(v interface{}, env map[string]string) (res interface{}) {
+	switch v1 := v.(type) {
+	case string:
+		res = Interpolate(v1, env)
+	case map[string]interface{}:
+		if v1 == nil {
+			res = v1
+			return
+		}
+		m := make(map[string]interface{}, len(v1))
+		for k, val := range v1 {
+			m[k] = interpolateConfig(val, env)
+		}
+		res = m
+	case []map[string]interface{}:
+		var l []map[string]interface{}
+		for _, val := range v1 {
+			l = append(l, interpolateConfig(val, env).(map[string]interface{}))
+		}
+		res = l
+	case []interface{}:
+		var l []interface{}
+		for _, val := range v1 {
+			l = append(l, interpolateConfig(val, env))
+		}
+		res = l
+	default:
+		res = v
+	}
+	return
+}
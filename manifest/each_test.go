@@ -0,0 +1,64 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package manifest_test
+
+import (
+	"github.com/da-moon/soil/lib"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPodSlice_Expand(t *testing.T) {
+	var buffers lib.StaticBuffers
+	var pods manifest.PodSlice
+	assert.NoError(t, buffers.ReadFiles("testdata/TestPodSlice_Expand_0.hcl"))
+	assert.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+
+	t.Run(`0 no meta`, func(t *testing.T) {
+		res, err := pods.Expand(map[string]string{})
+		assert.NoError(t, err)
+		assert.Equal(t, manifest.PodSlice{pods[0]}, res)
+	})
+	t.Run(`1 expand`, func(t *testing.T) {
+		res, err := pods.Expand(map[string]string{
+			"meta.groups": "first, second,,",
+		})
+		assert.NoError(t, err)
+		assert.Len(t, res, 3)
+		assert.Equal(t, "single", res[0].Name)
+		assert.Equal(t, &manifest.Pod{
+			Namespace: manifest.PrivateNamespace,
+			Name:      "worker-first",
+			Each:      "first",
+			Runtime:   true,
+			Target:    "multi-user.target",
+			Constraint: manifest.Constraint{
+				"${meta.groups}": "~ first",
+			},
+			Units: manifest.Units{
+				{
+					Name: "worker-first.service",
+					Transition: manifest.Transition{
+						Create: "start", Update: "restart", Destroy: "stop",
+					},
+					Source: "# first ${meta.groups}",
+				},
+			},
+			Resources: manifest.Resources{
+				{Name: "main", Provider: "worker-first.port-first", Config: map[string]interface{}{"fixed": "first"}},
+			},
+			Providers: manifest.Providers{
+				{Kind: "range", Name: "port-first", Config: map[string]interface{}{"min": 8000, "max": 9000}},
+			},
+		}, res[1])
+		assert.Equal(t, "worker-second", res[2].Name)
+		assert.Equal(t, "${meta.groups}", pods[1].ForEach, "source should not be modified")
+	})
+	t.Run(`2 same element mark`, func(t *testing.T) {
+		res1, _ := pods.Expand(map[string]string{"meta.groups": "first,second"})
+		res2, _ := pods.Expand(map[string]string{"meta.groups": "second,third"})
+		assert.Equal(t, res1[2].Mark(), res2[1].Mark())
+	})
+}
@@ -42,7 +42,12 @@ func (r *PodSlice) Unmarshal(namespace string, reader ...io.Reader) (err error)
 	err = &multierror.Error{}
 	roots, parseErr := lib.ParseHCL(reader...)
 	err = multierror.Append(err, parseErr)
-	err = multierror.Append(err, ParseList(roots, "pod", r))
+	var templates Templates
+	err = multierror.Append(err, ParseList(roots, "template", &templates))
+	err = multierror.Append(err, ParseList(roots, "pod", &inheritingList{
+		ListParser: r,
+		templates:  templates,
+	}))
 	r.SetNamespace(namespace)
 	err = err.(*multierror.Error).ErrorOrNil()
 	return
@@ -52,13 +57,19 @@ func (r *PodSlice) Unmarshal(namespace string, reader ...io.Reader) (err error)
 type Pod struct {
 	Namespace  string
 	Name       string
+	From       string `json:",omitempty"`                // Template name
+	ForEach    string `json:",omitempty" hcl:"for_each"` // Comma separated list to expand pod
+	Each       string `json:",omitempty" hcl:"-"`        // Element of expanded pod
 	Runtime    bool
+	User       string `json:",omitempty"` // Owner of systemd user instance
+	Mode       string `json:",omitempty"` // Empty or "transient"
 	Target     string
 	Constraint Constraint `json:",omitempty"`
 	Units      Units      `json:",omitempty" hcl:"-"`
 	Blobs      Blobs      `json:",omitempty" hcl:"-"`
 	Resources  Resources  `json:",omitempty" hcl:"-"`
 	Providers  Providers  `json:",omitempty" hcl:"-"`
+	Secrets    Secrets    `json:",omitempty" hcl:"-"`
 }
 
 func (p Pod) GetID(parent ...string) string {
@@ -75,9 +86,11 @@ func (p *Pod) ParseAST(raw *ast.ObjectItem) (err error) {
 	p.Name = raw.Keys[0].Token.Value().(string)
 
 	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "unit", &p.Units))
+	p.Units.setActivatedDefaults(list)
 	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "blob", &p.Blobs))
 	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "resource", &p.Resources))
 	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "provider", &p.Providers))
+	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "secret", &p.Secrets))
 
 	err = err.(*multierror.Error).ErrorOrNil()
 	return
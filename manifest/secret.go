@@ -0,0 +1,158 @@
+package manifest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"regexp"
+	"strings"
+)
+
+// SecretPrefix marks encrypted secret values
+const SecretPrefix = "soil-secret:v1:"
+
+var secretRe = regexp.MustCompile(regexp.QuoteMeta(SecretPrefix) + `[A-Za-z0-9+/=]+`)
+
+// RedactSecrets replaces all encrypted secret values in given string
+func RedactSecrets(s string) (res string) {
+	res = secretRe.ReplaceAllString(s, SecretPrefix+"<redacted>")
+	return
+}
+
+type Secrets []Secret
+
+func (s *Secrets) Empty() ObjectParser {
+	return &Secret{}
+}
+
+func (s *Secrets) Append(v interface{}) (err error) {
+	v1 := v.(*Secret)
+	*s = append(*s, *v1)
+	return
+}
+
+// Secret is value encrypted with cluster public key. Secrets are decrypted
+// by agents on allocation and available for interpolation as
+// ${secret.<name>}.
+type Secret struct {
+	Name  string
+	Value string
+}
+
+func (s Secret) GetID(parent ...string) string {
+	return strings.Join(append(parent, s.Name), ".")
+}
+
+func (s *Secret) ParseAST(raw *ast.ObjectItem) (err error) {
+	s.Name = raw.Keys[0].Token.Value().(string)
+	if err = hcl.DecodeObject(s, raw); err != nil {
+		return
+	}
+	if !strings.HasPrefix(s.Value, SecretPrefix) {
+		err = fmt.Errorf(`secret %s: value should be encrypted`, s.Name)
+	}
+	return
+}
+
+// SecretKey is NaCl box key pair used to decrypt secrets
+type SecretKey struct {
+	Public  *[32]byte
+	Private *[32]byte
+}
+
+// GenerateSecretKey returns new random key pair
+func GenerateSecretKey() (k *SecretKey, err error) {
+	k = &SecretKey{}
+	k.Public, k.Private, err = box.GenerateKey(rand.Reader)
+	return
+}
+
+// ParseSecretKey returns key pair from base64 encoded private key
+func ParseSecretKey(private string) (k *SecretKey, err error) {
+	raw, err := parseSecretKeyBytes(private)
+	if err != nil {
+		return
+	}
+	k = &SecretKey{
+		Public:  &[32]byte{},
+		Private: raw,
+	}
+	curve25519.ScalarBaseMult(k.Public, k.Private)
+	return
+}
+
+// ParseSecretPublicKey returns key pair with only public key from base64
+// encoded public key. Such key can only encrypt.
+func ParseSecretPublicKey(public string) (k *SecretKey, err error) {
+	raw, err := parseSecretKeyBytes(public)
+	if err != nil {
+		return
+	}
+	k = &SecretKey{
+		Public: raw,
+	}
+	return
+}
+
+// PublicString returns base64 encoded public key
+func (k *SecretKey) PublicString() (res string) {
+	res = base64.StdEncoding.EncodeToString(k.Public[:])
+	return
+}
+
+// PrivateString returns base64 encoded private key
+func (k *SecretKey) PrivateString() (res string) {
+	res = base64.StdEncoding.EncodeToString(k.Private[:])
+	return
+}
+
+// Encrypt returns secret value with given plaintext sealed by public key
+func (k *SecretKey) Encrypt(plaintext string) (res string, err error) {
+	sealed, err := box.SealAnonymous(nil, []byte(plaintext), k.Public, rand.Reader)
+	if err != nil {
+		return
+	}
+	res = SecretPrefix + base64.StdEncoding.EncodeToString(sealed)
+	return
+}
+
+// Decrypt returns plaintext of given secret value
+func (k *SecretKey) Decrypt(value string) (res string, err error) {
+	if k.Private == nil {
+		err = fmt.Errorf(`private key is not defined`)
+		return
+	}
+	if !strings.HasPrefix(value, SecretPrefix) {
+		err = fmt.Errorf(`value is not encrypted`)
+		return
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, SecretPrefix))
+	if err != nil {
+		return
+	}
+	plaintext, ok := box.OpenAnonymous(nil, sealed, k.Public, k.Private)
+	if !ok {
+		err = fmt.Errorf(`can not decrypt value`)
+		return
+	}
+	res = string(plaintext)
+	return
+}
+
+func parseSecretKeyBytes(s string) (res *[32]byte, err error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return
+	}
+	if len(raw) != 32 {
+		err = fmt.Errorf(`key should be 32 bytes: got %d`, len(raw))
+		return
+	}
+	res = &[32]byte{}
+	copy(res[:], raw)
+	return
+}
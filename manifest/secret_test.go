@@ -0,0 +1,65 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package manifest_test
+
+import (
+	"fmt"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSecretKey(t *testing.T) {
+	key, err := manifest.GenerateSecretKey()
+	assert.NoError(t, err)
+	public, err := manifest.ParseSecretPublicKey(key.PublicString())
+	assert.NoError(t, err)
+	private, err := manifest.ParseSecretKey(key.PrivateString())
+	assert.NoError(t, err)
+	assert.Equal(t, key, private)
+
+	value, err := public.Encrypt("hunter2")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(value, manifest.SecretPrefix))
+	assert.NotContains(t, value, "hunter2")
+
+	t.Run(`decrypt`, func(t *testing.T) {
+		res, err := private.Decrypt(value)
+		assert.NoError(t, err)
+		assert.Equal(t, "hunter2", res)
+	})
+	t.Run(`public only`, func(t *testing.T) {
+		_, err := public.Decrypt(value)
+		assert.Error(t, err)
+	})
+	t.Run(`wrong key`, func(t *testing.T) {
+		other, _ := manifest.GenerateSecretKey()
+		_, err := other.Decrypt(value)
+		assert.Error(t, err)
+	})
+	t.Run(`bad key`, func(t *testing.T) {
+		_, err := manifest.ParseSecretKey("c2hvcnQ=")
+		assert.Error(t, err)
+	})
+	t.Run(`redact`, func(t *testing.T) {
+		assert.Equal(t, `{"Value":"soil-secret:v1:<redacted>"}`, manifest.RedactSecrets(fmt.Sprintf(`{"Value":"%s"}`, value)))
+	})
+	t.Run(`parse`, func(t *testing.T) {
+		var pods manifest.PodSlice
+		assert.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, strings.NewReader(fmt.Sprintf(`
+			pod "db" {
+				secret "password" {
+					value = "%s"
+				}
+			}`, value))))
+		assert.Equal(t, manifest.Secrets{{Name: "password", Value: value}}, pods[0].Secrets)
+		assert.Error(t, pods.Unmarshal(manifest.PrivateNamespace, strings.NewReader(`
+			pod "db" {
+				secret "password" {
+					value = "plaintext"
+				}
+			}`)))
+	})
+}
@@ -0,0 +1,249 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+	"strings"
+)
+
+const (
+	templateFromKey       = "from"
+	templateRemoveKey     = "remove"
+	templateConstraintKey = "constraint"
+)
+
+type Templates []*Template
+
+func (t *Templates) Empty() ObjectParser {
+	return &Template{}
+}
+
+func (t *Templates) Append(v interface{}) (err error) {
+	*t = append(*t, v.(*Template))
+	return
+}
+
+// Template is named pod prototype. Pods and other templates can inherit
+// template by "from" field. Templates are merged with inheritors on AST
+// level before decode.
+type Template struct {
+	Name string `hcl:"-"`
+	From string
+
+	body *ast.ObjectList
+}
+
+func (t Template) GetID(parent ...string) string {
+	return strings.Join(append(parent, t.Name), ".")
+}
+
+func (t *Template) ParseAST(raw *ast.ObjectItem) (err error) {
+	t.Name = raw.Keys[0].Token.Value().(string)
+	obj, ok := raw.Val.(*ast.ObjectType)
+	if !ok {
+		err = fmt.Errorf(`template %s should be an object`, t.Name)
+		return
+	}
+	if err = hcl.DecodeObject(t, raw); err != nil {
+		return
+	}
+	t.body = obj.List
+	return
+}
+
+// Inherit returns given item merged with all its ancestors. Item is returned
+// as is if "from" is not defined.
+func (t Templates) Inherit(raw *ast.ObjectItem) (res *ast.ObjectItem, err error) {
+	obj, ok := raw.Val.(*ast.ObjectType)
+	if !ok {
+		res = raw
+		return
+	}
+	var decl struct {
+		From string
+	}
+	if err = hcl.DecodeObject(&decl, raw); err != nil {
+		return
+	}
+	if decl.From == "" {
+		res = raw
+		return
+	}
+	base, err := t.resolve(decl.From, map[string]struct{}{})
+	if err != nil {
+		return
+	}
+	res = &ast.ObjectItem{
+		Keys:   raw.Keys,
+		Assign: raw.Assign,
+		Val: &ast.ObjectType{
+			Lbrace: obj.Lbrace,
+			Rbrace: obj.Rbrace,
+			List:   mergeObjectLists(base, obj.List, false),
+		},
+	}
+	return
+}
+
+// resolve returns template body merged with all ancestors without "from" field
+func (t Templates) resolve(name string, seen map[string]struct{}) (res *ast.ObjectList, err error) {
+	if _, ok := seen[name]; ok {
+		err = fmt.Errorf(`template %s: circular inheritance`, name)
+		return
+	}
+	seen[name] = struct{}{}
+	var tpl *Template
+	for _, candidate := range t {
+		if candidate.Name == name {
+			tpl = candidate
+			break
+		}
+	}
+	if tpl == nil {
+		err = fmt.Errorf(`template %s not found`, name)
+		return
+	}
+	own := &ast.ObjectList{}
+	for _, item := range tpl.body.Items {
+		if itemKey(item) != templateFromKey {
+			own.Add(item)
+		}
+	}
+	if tpl.From == "" {
+		res = own
+		return
+	}
+	base, err := t.resolve(tpl.From, seen)
+	if err != nil {
+		err = fmt.Errorf(`template %s: %v`, name, err)
+		return
+	}
+	res = mergeObjectLists(base, own, false)
+	return
+}
+
+// mergeObjectLists deep merges override into base. Objects with equal keys
+// are merged recursively, other values are replaced. Objects with
+// "remove = true" and, in constraints, pairs with empty value remove
+// inherited entries.
+func mergeObjectLists(base, override *ast.ObjectList, inConstraint bool) (res *ast.ObjectList) {
+	res = &ast.ObjectList{}
+	index := map[string]int{}
+	for _, item := range base.Items {
+		if key := itemKey(item); key != "" {
+			if _, ok := index[key]; !ok {
+				index[key] = len(res.Items)
+			}
+		}
+		res.Add(item)
+	}
+	removed := map[int]struct{}{}
+	for _, item := range override.Items {
+		key := itemKey(item)
+		pos, exists := index[key]
+		if key == "" || !exists {
+			if !isRemoval(item, inConstraint) {
+				res.Add(item)
+			}
+			continue
+		}
+		if isRemoval(item, inConstraint) {
+			removed[pos] = struct{}{}
+			continue
+		}
+		baseObj, baseIsObj := res.Items[pos].Val.(*ast.ObjectType)
+		overObj, overIsObj := item.Val.(*ast.ObjectType)
+		if !baseIsObj || !overIsObj {
+			res.Items[pos] = item
+			continue
+		}
+		res.Items[pos] = &ast.ObjectItem{
+			Keys:        item.Keys,
+			Assign:      item.Assign,
+			LeadComment: item.LeadComment,
+			LineComment: item.LineComment,
+			Val: &ast.ObjectType{
+				Lbrace: overObj.Lbrace,
+				Rbrace: overObj.Rbrace,
+				List: mergeObjectLists(
+					baseObj.List, overObj.List,
+					len(item.Keys) == 1 && item.Keys[0].Token.Value() == templateConstraintKey),
+			},
+		}
+	}
+	if len(removed) > 0 {
+		var items []*ast.ObjectItem
+		for i, item := range res.Items {
+			if _, ok := removed[i]; !ok {
+				items = append(items, item)
+			}
+		}
+		res.Items = items
+	}
+	return
+}
+
+// isRemoval returns true if item removes inherited entry
+func isRemoval(item *ast.ObjectItem, inConstraint bool) (res bool) {
+	switch v := item.Val.(type) {
+	case *ast.ObjectType:
+		for _, child := range v.List.Items {
+			if itemKey(child) != templateRemoveKey {
+				continue
+			}
+			if lit, ok := child.Val.(*ast.LiteralType); ok && lit.Token.Type == token.BOOL {
+				res, _ = lit.Token.Value().(bool)
+			}
+		}
+	case *ast.LiteralType:
+		res = inConstraint && v.Token.Type == token.STRING && v.Token.Value() == ""
+	}
+	return
+}
+
+// itemKey returns item keys joined by space
+func itemKey(item *ast.ObjectItem) (res string) {
+	var keys []string
+	for _, key := range item.Keys {
+		if v, ok := key.Token.Value().(string); ok {
+			keys = append(keys, v)
+		}
+	}
+	res = strings.Join(keys, " ")
+	return
+}
+
+// inheritingList resolves templates before passing items to underlying parser
+type inheritingList struct {
+	ListParser
+	templates Templates
+}
+
+func (l *inheritingList) Empty() ObjectParser {
+	return &inheritingObject{
+		ObjectParser: l.ListParser.Empty(),
+		templates:    l.templates,
+	}
+}
+
+func (l *inheritingList) Append(v interface{}) (err error) {
+	err = l.ListParser.Append(v.(*inheritingObject).ObjectParser)
+	return
+}
+
+type inheritingObject struct {
+	ObjectParser
+	templates Templates
+}
+
+func (o *inheritingObject) ParseAST(raw *ast.ObjectItem) (err error) {
+	merged, err := o.templates.Inherit(raw)
+	if err != nil {
+		err = fmt.Errorf(`%s: %v`, raw.Keys[0].Token.Value(), err)
+		return
+	}
+	err = o.ObjectParser.ParseAST(merged)
+	return
+}
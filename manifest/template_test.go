@@ -0,0 +1,110 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package manifest_test
+
+import (
+	"github.com/da-moon/soil/lib"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestTemplates_Inherit(t *testing.T) {
+	t.Run(`0 merge`, func(t *testing.T) {
+		var buffers lib.StaticBuffers
+		var pods manifest.PodSlice
+		assert.NoError(t, buffers.ReadFiles("testdata/TestTemplates_0.hcl"))
+		assert.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+		assert.Equal(t, manifest.PodSlice{
+			{
+				Namespace: manifest.PrivateNamespace,
+				Name:      "web-1",
+				From:      "web",
+				Runtime:   false,
+				Target:    "default.target",
+				Constraint: manifest.Constraint{
+					"${meta.role}": "web",
+					"${meta.rack}": "left",
+				},
+				Units: manifest.Units{
+					{
+						Name: "web.service",
+						Transition: manifest.Transition{
+							Create: "start", Update: "reload", Destroy: "stop", Permanent: true,
+						},
+						Source: "base",
+					},
+				},
+				Blobs: manifest.Blobs{
+					{Name: "/etc/web/env", Permissions: 0600, Source: "web-1"},
+				},
+				Resources: manifest.Resources{
+					{Name: "http", Provider: "range", Config: map[string]interface{}{"fixed": 8080}},
+				},
+				Providers: manifest.Providers{
+					{Kind: "range", Name: "port", Config: map[string]interface{}{"min": 8000, "max": 8100}},
+				},
+			},
+			{
+				Namespace: manifest.PrivateNamespace,
+				Name:      "web-2",
+				From:      "web",
+				Runtime:   false,
+				Target:    "default.target",
+				Constraint: manifest.Constraint{
+					"${meta.role}": "web",
+					"${meta.zone}": "a",
+				},
+				Units: manifest.Units{
+					{
+						Name: "debug.service",
+						Transition: manifest.Transition{
+							Create: "start", Update: "restart", Destroy: "stop",
+						},
+						Source: "debug",
+					},
+					{
+						Name: "web.service",
+						Transition: manifest.Transition{
+							Create: "start", Update: "reload", Destroy: "stop", Permanent: true,
+						},
+						Source: "base",
+					},
+				},
+				Blobs: manifest.Blobs{
+					{Name: "/etc/web/env", Permissions: 0600, Source: "env"},
+				},
+				Resources: manifest.Resources{
+					{Name: "http", Provider: "range", Config: map[string]interface{}{"fixed": 8080}},
+				},
+				Providers: manifest.Providers{
+					{Kind: "range", Name: "port", Config: map[string]interface{}{"min": 8000, "max": 9000}},
+				},
+			},
+		}, pods)
+	})
+	t.Run(`1 template change changes mark`, func(t *testing.T) {
+		var buffers lib.StaticBuffers
+		var pods manifest.PodSlice
+		assert.NoError(t, buffers.ReadFiles("testdata/TestTemplates_0.hcl"))
+		assert.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+
+		var changed manifest.PodSlice
+		src := strings.Replace(string(buffers[0]), `source = "base"`, `source = "changed"`, 1)
+		assert.NoError(t, changed.Unmarshal(manifest.PrivateNamespace, strings.NewReader(src)))
+		assert.Len(t, changed, 2)
+		for i := range pods {
+			assert.NotEqual(t, pods[i].Mark(), changed[i].Mark())
+		}
+	})
+	t.Run(`2 failures`, func(t *testing.T) {
+		var buffers lib.StaticBuffers
+		var pods manifest.PodSlice
+		assert.NoError(t, buffers.ReadFiles("testdata/TestTemplates_1.hcl"))
+		assert.Error(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+		assert.Len(t, pods, 1)
+		assert.Equal(t, "ok", pods[0].Name)
+	})
+}
@@ -0,0 +1,23 @@
+pod "binary" {
+  blob "/etc/binary/plain" {
+    encoding = "base64"
+    source = <<EOF
+      aGVsbG8A
+      d29ybGQ=
+    EOF
+  }
+  blob "/etc/binary/gzip" {
+    encoding = "gzip+base64"
+    source = "H4sIAAAAAAACA8tIzcnJZyjPL8pJAQCzFOYKCwAAAA=="
+  }
+  unit "binary.service" {
+    source = "# ${blob.etc-binary-plain} ${blob.etc-binary-gzip}"
+  }
+}
+
+pod "unknown" {
+  blob "/etc/unknown" {
+    encoding = "rot13"
+    source = "uryyb"
+  }
+}
@@ -0,0 +1,29 @@
+pod "file" {
+  blob "/etc/file/config" {
+    source_file = "testdata/TestBlob_SourceFile_0.txt"
+  }
+  blob "/etc/file/static" {
+    kind = "archive"
+    source_file = "testdata/TestBlob_SourceFile_0.txt"
+  }
+}
+
+pod "both" {
+  blob "/etc/both" {
+    source = "a"
+    source_file = "testdata/TestBlob_SourceFile_0.txt"
+  }
+}
+
+pod "archive" {
+  blob "/etc/archive" {
+    kind = "archive"
+    source = "a"
+  }
+}
+
+pod "unknown" {
+  blob "/etc/unknown" {
+    kind = "dir"
+  }
+}
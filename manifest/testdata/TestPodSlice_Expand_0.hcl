@@ -0,0 +1,18 @@
+pod "worker-${each}" {
+  for_each = "${meta.groups}"
+  constraint {
+    "${meta.groups}" = "~ ${each}"
+  }
+  unit "worker-${each}.service" {
+    source = "# ${each} ${meta.groups}"
+  }
+  provider "range" "port-${each}" {
+    min = 8000
+    max = 9000
+  }
+  resource "worker-${each}.port-${each}" "main" {
+    fixed = "${each}"
+  }
+}
+
+pod "single" {}
@@ -0,0 +1,54 @@
+template "base" {
+  runtime = false
+  constraint {
+    "${meta.role}" = "web"
+    "${meta.zone}" = "a"
+  }
+  provider "range" "port" {
+    min = 8000
+    max = 9000
+  }
+  resource "range" "http" {
+    fixed = 8080
+  }
+  unit "web.service" {
+    permanent = true
+    source = "base"
+  }
+  unit "debug.service" {
+    source = "debug"
+  }
+  blob "/etc/web/env" {
+    permissions = 0600
+    source = "env"
+  }
+}
+
+template "web" {
+  from = "base"
+  target = "default.target"
+  unit "web.service" {
+    update = "reload"
+  }
+}
+
+pod "web-1" {
+  from = "web"
+  constraint {
+    "${meta.zone}" = ""
+    "${meta.rack}" = "left"
+  }
+  provider "range" "port" {
+    max = 8100
+  }
+  unit "debug.service" {
+    remove = true
+  }
+  blob "/etc/web/env" {
+    source = "web-1"
+  }
+}
+
+pod "web-2" {
+  from = "web"
+}
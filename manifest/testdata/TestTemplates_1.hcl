@@ -0,0 +1,17 @@
+template "a" {
+  from = "b"
+}
+
+template "b" {
+  from = "a"
+}
+
+pod "cycle" {
+  from = "a"
+}
+
+pod "missing" {
+  from = "nonexistent"
+}
+
+pod "ok" {}
@@ -0,0 +1,21 @@
+pod "jobs" {
+  unit "backup.timer" {
+    permanent = true
+    source = <<EOF
+      [Timer]
+      OnCalendar=daily
+      [Install]
+      WantedBy=timers.target
+    EOF
+  }
+  unit "backup.service" {
+    source = "[Service]\nType=oneshot"
+  }
+  unit "api.socket" {
+    source = "[Socket]\nListenStream=8080\nUnit=api-server.service"
+  }
+  unit "api-server.service" {
+    create = "start"
+  }
+  unit "plain.service" {}
+}
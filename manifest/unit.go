@@ -1,11 +1,26 @@
 package manifest
 
 import (
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 	"strings"
 )
 
+const (
+	unitTypeService = "service"
+	unitTypeTimer   = "timer"
+	unitTypeSocket  = "socket"
+	unitTypePath    = "path"
+)
+
+// Trigger sections by trigger unit type
+var triggerSections = map[string]string{
+	unitTypeTimer:  "[Timer]",
+	unitTypeSocket: "[Socket]",
+	unitTypePath:   "[Path]",
+}
+
 type Units []Unit
 
 func (u *Units) Empty() ObjectParser {
@@ -28,6 +43,7 @@ type Unit struct {
 	Transition `json:",omitempty" hcl:",squash"`
 	Name       string
 	Source     string
+	DropIns    DropIns `json:",omitempty" hcl:"-"`
 }
 
 func (u Unit) GetID(parent ...string) string {
@@ -35,9 +51,96 @@ func (u Unit) GetID(parent ...string) string {
 }
 
 func (u *Unit) ParseAST(raw *ast.ObjectItem) (err error) {
+	err = &multierror.Error{}
 	u.Name = raw.Keys[0].Token.Value().(string)
-	err = hcl.DecodeObject(u, raw)
+	if err = multierror.Append(err, hcl.DecodeObject(u, raw)); err.(*multierror.Error).ErrorOrNil() != nil {
+		return
+	}
 	u.Source = Heredoc(u.Source)
+	if obj, ok := raw.Val.(*ast.ObjectType); ok {
+		err = multierror.Append(err, ParseList([]*ast.ObjectList{obj.List}, "dropin", &u.DropIns))
+	}
+	err = err.(*multierror.Error).ErrorOrNil()
+	return
+}
+
+// Type returns unit type by unit name suffix
+func (u Unit) Type() (res string) {
+	res = UnitType(u.Name)
+	return
+}
+
+// Activates returns name of unit activated by trigger unit or empty string
+// if unit is not a trigger. Activated unit is defined by "Unit=" in trigger
+// section or has the same name as trigger with ".service" suffix.
+func (u Unit) Activates() (res string) {
+	section, ok := triggerSections[u.Type()]
+	if !ok {
+		return
+	}
+	res = strings.TrimSuffix(u.Name, "."+u.Type()) + "." + unitTypeService
+	var inSection bool
+	for _, line := range strings.Split(u.Source, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inSection = line == section
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if value := strings.TrimPrefix(line, "Unit="); value != line {
+			res = strings.TrimSpace(value)
+		}
+		if u.Type() == unitTypeSocket && (line == "Accept=yes" || line == "Accept=true") {
+			res = strings.TrimSuffix(u.Name, "."+u.Type()) + "@." + unitTypeService
+		}
+	}
+	return
+}
+
+// setActivatedDefaults sets transitions not defined in given unit stanzas for
+// units activated by triggers in the same slice. Activated units are not
+// started on creation and restarted on update only if they are running.
+func (u Units) setActivatedDefaults(list *ast.ObjectList) {
+	explicit := map[string]struct{}{}
+	for _, item := range list.Filter("unit").Items {
+		if obj, ok := item.Val.(*ast.ObjectType); ok && len(item.Keys) > 0 {
+			for _, child := range obj.List.Items {
+				explicit[item.Keys[0].Token.Value().(string)+" "+itemKey(child)] = struct{}{}
+			}
+		}
+	}
+	activated := map[string]struct{}{}
+	for _, unit := range u {
+		if name := unit.Activates(); name != "" {
+			activated[name] = struct{}{}
+		}
+	}
+	for i := range u {
+		if _, ok := activated[u[i].Name]; !ok {
+			continue
+		}
+		if _, ok := explicit[u[i].Name+" create"]; !ok {
+			u[i].Create = ""
+		}
+		if _, ok := explicit[u[i].Name+" update"]; !ok {
+			u[i].Update = "try-restart"
+		}
+	}
+}
+
+// UnitType returns unit type by unit name suffix
+func UnitType(name string) (res string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		res = name[i+1:]
+	}
+	return
+}
+
+// IsTrigger returns true if unit with given name activates other units
+func IsTrigger(name string) (ok bool) {
+	_, ok = triggerSections[UnitType(name)]
 	return
 }
 
@@ -48,3 +151,31 @@ type Transition struct {
 	Destroy   string `json:",omitempty"`
 	Permanent bool   `json:",omitempty"`
 }
+
+type DropIns []DropIn
+
+func (d *DropIns) Empty() ObjectParser {
+	return &DropIn{}
+}
+
+func (d *DropIns) Append(v interface{}) (err error) {
+	*d = append(*d, *v.(*DropIn))
+	return
+}
+
+// DropIn is unit configuration override written to "<unit>.d/<name>"
+type DropIn struct {
+	Name   string
+	Source string
+}
+
+func (d DropIn) GetID(parent ...string) string {
+	return strings.Join(append(parent, d.Name), ".")
+}
+
+func (d *DropIn) ParseAST(raw *ast.ObjectItem) (err error) {
+	d.Name = raw.Keys[0].Token.Value().(string)
+	err = hcl.DecodeObject(d, raw)
+	d.Source = Heredoc(d.Source)
+	return
+}
@@ -0,0 +1,46 @@
+//go:build ide || test_unit
+// +build ide test_unit
+
+package manifest_test
+
+import (
+	"github.com/da-moon/soil/lib"
+	"github.com/da-moon/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnit_Activates(t *testing.T) {
+	cases := []struct {
+		unit   manifest.Unit
+		expect string
+	}{
+		{manifest.Unit{Name: "a.service"}, ""},
+		{manifest.Unit{Name: "a.timer"}, "a.service"},
+		{manifest.Unit{Name: "a.path", Source: "[Path]\nPathExists=/tmp/a\nUnit=b.service"}, "b.service"},
+		{manifest.Unit{Name: "a.socket", Source: "[Unit]\nUnit=wrong.service\n[Socket]\nAccept=yes"}, "a@.service"},
+	}
+	for _, c := range cases {
+		t.Run(c.unit.Name, func(t *testing.T) {
+			assert.Equal(t, c.expect, c.unit.Activates())
+		})
+	}
+}
+
+func TestUnits_ActivatedDefaults(t *testing.T) {
+	var buffers lib.StaticBuffers
+	var pods manifest.PodSlice
+	assert.NoError(t, buffers.ReadFiles("testdata/TestUnits_Activated_0.hcl"))
+	assert.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+	transitions := map[string]manifest.Transition{}
+	for _, u := range pods[0].Units {
+		transitions[u.Name] = u.Transition
+	}
+	assert.Equal(t, map[string]manifest.Transition{
+		"api-server.service": {Create: "start", Update: "try-restart", Destroy: "stop"},
+		"api.socket":         {Create: "start", Update: "restart", Destroy: "stop"},
+		"backup.service":     {Create: "", Update: "try-restart", Destroy: "stop"},
+		"backup.timer":       {Create: "start", Update: "restart", Destroy: "stop", Permanent: true},
+		"plain.service":      {Create: "start", Update: "restart", Destroy: "stop"},
+	}, transitions)
+}
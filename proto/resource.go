@@ -0,0 +1,58 @@
+package proto
+
+const (
+	V1Resources = "/v1/resources"
+	V1Providers = "/v1/providers"
+)
+
+// ProviderInfo describes resource provider on agent
+type ProviderInfo struct {
+	ID     string                 // Full provider ID "<pod>.<name>"
+	Pod    string                 // Owning pod
+	Name   string                 // Provider name
+	Kind   string                 // Estimator kind
+	Config map[string]interface{} // Provider config
+	Used   int                    // Number of allocated resources
+	Failed int                    // Number of failed resources
+	Total  uint64                 `json:",omitempty"` // Number of values which can be allocated if known
+}
+
+type ProvidersInfo []ProviderInfo
+
+func (c ProvidersInfo) Len() int {
+	return len(c)
+}
+
+func (c ProvidersInfo) Less(i, j int) bool {
+	return c[i].ID < c[j].ID
+}
+
+func (c ProvidersInfo) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+// ResourceInfo describes resource request and its allocation state
+type ResourceInfo struct {
+	ID        string                 // Full resource ID "<pod>.<name>"
+	Pod       string                 // Requesting pod
+	Name      string                 // Resource name
+	Provider  string                 // Full provider ID
+	Config    map[string]interface{} // Resource request config
+	Allocated bool                   // Allocation state
+	Values    map[string]string      `json:",omitempty"` // Allocated values
+	Failure   string                 `json:",omitempty"` // Failure if allocation is failed
+}
+
+type ResourcesInfo []ResourceInfo
+
+func (c ResourcesInfo) Len() int {
+	return len(c)
+}
+
+func (c ResourcesInfo) Less(i, j int) bool {
+	return c[i].ID < c[j].ID
+}
+
+func (c ResourcesInfo) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
@@ -1,5 +1,6 @@
 package proto
 
 const (
+	V1Registry     = "/v1/registry"
 	V1RegistryPods = "/v1/registry/pods"
 )
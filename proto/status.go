@@ -1,5 +1,20 @@
 package proto
 
+const (
+	V1StatusPing  = "/v1/status/ping"
+	V1StatusNode  = "/v1/status/node"
+	V1StatusNodes = "/v1/status/nodes"
+)
+
+// NodeStatus describes state of agent which accepts request
+type NodeStatus struct {
+	ID      string
+	Version string
+	API     string
+	Drain   bool                // Drain mode is on
+	Drift   map[string][]string `json:",omitempty"` // Drifted paths by pod
+}
+
 type NodeInfo struct {
 	ID        string
 	Advertise string